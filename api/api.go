@@ -1,15 +1,22 @@
 package api
 
 import (
+	"context"
 	"time"
 	"fmt"
 	"math"
+	"sync"
 	"strconv"
+	"strings"
 	"slices"
+	"errors"
 	"net/http"
 	"encoding/json"
 	"github.com/sergeykochiev/ivgpu-schedule/common"
+	"github.com/sergeykochiev/ivgpu-schedule/calendar"
+	"github.com/sergeykochiev/ivgpu-schedule/i18n"
 	"github.com/sergeykochiev/ivgpu-schedule/tg"
+	"github.com/sergeykochiev/ivgpu-schedule/metrics"
 )
 
 type GrouplistGroup struct {
@@ -31,19 +38,6 @@ type GrouplistInstitute struct {
 
 type GrouplistResponse []GrouplistInstitute
 
-// type LessonTimes struct {
-// 	All string `json:"-1"`
-// 	First string `json:"0"`
-// 	Second string `json:"1"`
-// 	Third string `json:"2"`
-// 	Forth string `json:"3"`
-// 	Fifth string `json:"4"`
-// 	Sixth string `json:"5"`
-// 	Seventh string `json:"6"`
-// }
-
-type LessonTimes map[string]string
-
 type Lecturer struct {
 	Id int `json:"id"`
 	FIO string `json:"FIO"`
@@ -80,15 +74,38 @@ type GroupSchedule struct {
 	LessonsOnPeriod LessonsOnPeriod `json:"lessons_on_period"`
 }
 
+type RemoteDesc struct {
+	RemoteLink string `json:"remote_link"`
+	RemoteAbr string `json:"remote_abr"`
+}
+
 type GroupResponse struct {
 	Mode string `json:"mode"`
-	LessonTimes LessonTimes `json:"lesson_times"`
-	LessonShortTimes LessonTimes `json:"lesson_short_times"`
-	RemoteDesc struct {
-		RemoteLink string `json:"remote_link"`
-		RemoteAbr string `json:"remote_abr"`
-	} `json:"remote_descr"`
+	LessonTimes Timetable `json:"lesson_times"`
+	LessonShortTimes Timetable `json:"lesson_short_times"`
+	RemoteDesc RemoteDesc `json:"remote_descr"`
 	Schedule []GroupSchedule `json:"rasp"`
+	// Malformed timetable entries, reported by Validate
+	timesErr error
+}
+
+// UnmarshalJSON parses the timetables itself to keep the errors of the
+// entries it drops
+func (gr *GroupResponse) UnmarshalJSON(b []byte) error {
+	type plain GroupResponse
+	aux := struct {
+		*plain
+		LessonTimes map[string]string `json:"lesson_times"`
+		LessonShortTimes map[string]string `json:"lesson_short_times"`
+	}{ plain: (*plain)(gr) }
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	var timesErr, shortErr error
+	gr.LessonTimes, timesErr = ParseTimetable(aux.LessonTimes)
+	gr.LessonShortTimes, shortErr = ParseTimetable(aux.LessonShortTimes)
+	gr.timesErr = errors.Join(timesErr, shortErr)
+	return nil
 }
 
 const (
@@ -104,114 +121,136 @@ const (
 
 const DateLayout = "2006-01-02"
 
-const (
-	EndpointGrouplist = "https://raspisanie.ivgpu.ru/api/grouplist"
-	Endpoint = "https://raspisanie.ivgpu.ru/api/rasp/?group_id="
-)
+const DefaultBase = "https://raspisanie.ivgpu.ru/api"
+
+// Base is the root of the schedule API, a mirror or a fake can be put here
+// before the first request
+var Base = DefaultBase
 
 func totime(date string) (t time.Time) {
-	t, _ = time.Parse(DateLayout, date)
+	t, _ = time.ParseInLocation(DateLayout, date, common.Location)
 	return
 }
 
 func fromtime(t time.Time) string {
-	return t.Format(DateLayout);
+	return t.In(common.Location).Format(DateLayout);
 }
 
-func timeBetween(t time.Time, start time.Time, end time.Time) bool {
-	return t.Compare(start) >= 0 && t.Compare(end) < 0
+// dateBetween compares calendar dates, end date included
+func dateBetween(t time.Time, start time.Time, end time.Time) bool {
+	day := common.StartOfDay(t)
+	return day.Compare(start) >= 0 && day.Compare(end) <= 0
 }
 
-func (gr GroupResponse) Exams() string {
-	var schedule GroupSchedule
-	for _, schedule = range(gr.Schedule) {
-		// TODO factor out into const
-		if schedule.EduForm == "exam_och" {
-			break
-		}
-	}
-	return fmt.Sprintf(
-		"Расписание экзаменов и консультаций\n\n%s",
-		schedule.LessonsOnPeriod.Readable(gr.LessonTimes, true),
-	)
+type ScheduleDay struct {
+	Date time.Time
+	// The regular period containing the date, or the exam one if it is
+	// the only one. Zero when State isn't PeriodActive.
+	Schedule GroupSchedule
+	State PeriodState
+	InSession bool
+	Short bool
+	Holiday bool
+	// Set on a transferred working day, lessons are those of this date
+	WorksAs time.Time
+	Week int
+	Weekday int
+	Lessons LessonsOnPeriod
 }
 
-func (gr GroupResponse) ByDate(t time.Time, userWeek int) string {
-	var schedule GroupSchedule
-	var start time.Time
-	var end time.Time
-	for _, schedule = range(gr.Schedule) {
-		start = totime(schedule.StartDate)
-		end = totime(schedule.EndDate)
-		if timeBetween(t, start, end) {
-			break
-		}
-	}
-	weekDay := common.WeekdayToISO(t.Weekday())
+// lessonsOn picks the lessons of a period held on date. Exam periods list
+// their entries by date, regular ones repeat by weekday and parity unless
+// limited to their dates. The parity is that of the week containing at,
+// which differs from date on a transferred working day: it follows the
+// weekday it works as, but stays in its own week.
+func (gs GroupSchedule) lessonsOn(date time.Time, at time.Time, userWeek int) (lessons LessonsOnPeriod) {
+	weekday := common.WeekdayToISO(date.Weekday())
 	week := userWeek
 	if userWeek == 0 {
-		week = schedule.WeekStart
-		if t.Compare(start.AddDate(0, 0, 7)) > 0 {
-			if week == 1 {
-				week = 2
-			} else {
-				week = 1
+		week = gs.WeekAt(at)
+	}
+	for _, lesson := range(gs.LessonsOnPeriod) {
+		if gs.IsExam() && len(lesson.Dates) > 0 {
+			if slices.Contains(lesson.Dates, fromtime(date)) {
+				lessons = append(lessons, lesson)
 			}
+			continue
 		}
-	}
-	var lessons LessonsOnPeriod
-	for _, lesson := range(schedule.LessonsOnPeriod) {
-		if lesson.WeekDay != weekDay || lesson.Week != week {
+		if lesson.WeekDay != weekday || lesson.Week != week {
 			continue
 		}
-		if userWeek == 0 && len(lesson.Dates) > 0 && !slices.Contains(lesson.Dates, fromtime(t)) {
+		// Upstream limits some lessons to certain dates, a pinned parity
+		// asks for the whole week pattern instead
+		if userWeek == 0 && len(lesson.Dates) > 0 && !slices.Contains(lesson.Dates, fromtime(date)) {
 			continue
 		}
 		lessons = append(lessons, lesson)
 	}
-	return fmt.Sprintf(
-		"Расписание на %d.%d, %s\n\n%s",
-		t.Day(),
-		t.Month(),
-		common.WeekdayNames[weekDay],
-		lessons.Readable(gr.LessonTimes, false),
-	)
+	return
 }
 
-func (l LessonOnPeriod) Readable(lt LessonTimes, withDate bool) (s string) {
-	if withDate {
-		t := totime(l.Dates[0])
-		s += fmt.Sprintf("%d.%d, %s\n", t.Day(), t.Month(), common.WeekdayNames[l.WeekDay])
+// Day collects the lessons held on t's date from every period containing
+// it, consulting the production calendar for holidays and transferred
+// working days. userWeek pins the parity, zero means the actual parity of
+// the date.
+func (gr GroupResponse) Day(t time.Time, userWeek int) (d ScheduleDay) {
+	d.Date = common.StartOfDay(t)
+	d.Weekday = common.WeekdayToISO(d.Date.Weekday())
+	d.Short = calendar.Default.IsShort(t)
+	d.Holiday = calendar.Default.IsHoliday(t)
+	d.State = gr.PeriodState(t)
+	d.InSession = gr.InSession(t)
+	if d.State != PeriodActive {
+		return
 	}
-	s += fmt.Sprintf(
-		"[%s] \"%s\"\n",
-		l.Form,
-		l.LessonTitle,
-	)
-	for i, lr := range(l.Lecturers) {
-		s += fmt.Sprintf(
-			"%s %s %s\n",
-			lr.SecondName,
-			lr.FirstName,
-			lr.MiddleName,
-		)
-		if i != len(l.Lecturers) - 1 {
-			s += ", "
-		}
+	d.Schedule, _ = gr.ScheduleAt(t)
+	d.Week = userWeek
+	if userWeek == 0 {
+		d.Week = d.Schedule.WeekAt(t)
+	}
+	if d.Holiday {
+		return
+	}
+	source := d.Date
+	if as, ok := calendar.Default.WorksAs(t); ok {
+		d.WorksAs = as
+		source = as
 	}
-	s += lt[fmt.Sprintf("%d", l.LessonTime)]
-	s += fmt.Sprintf(", %s\n\n", l.Room[0])
+	regular, exam := gr.Periods(source)
+	for _, schedule := range(append(regular, exam...)) {
+		d.Lessons = append(d.Lessons, schedule.lessonsOn(source, t, userWeek)...)
+	}
+	slices.SortStableFunc(d.Lessons, func(a, b LessonOnPeriod) int {
+		return a.LessonTime - b.LessonTime
+	})
 	return
 }
 
-func (ll LessonsOnPeriod) Readable(lt LessonTimes, withDate bool) (s string) {
-	if len(ll) == 0 {
-		return "Пар нет"
+func (gr GroupResponse) ByDate(f tg.Formatter, lang i18n.Lang, t time.Time, userWeek int) (string, error) {
+	d := gr.Day(t, userWeek)
+	view := DayView{
+		Date: shortDate(d.Date),
+		Weekday: i18n.Weekday(lang, d.Weekday),
+		NotStarted: d.State == PeriodNotStarted,
+		Finished: d.State == PeriodFinished,
+		Missing: d.State == PeriodNone,
+		Short: d.Short,
+		Holiday: d.Holiday,
+		Lessons: d.Lessons.View(gr.Times(d.Short), gr.RemoteDesc),
 	}
-	for _, l := range(ll) {
-		s += l.Readable(lt, withDate)
+	if d.State == PeriodActive {
+		view.WeekNumber = d.Schedule.WeekNumber(t)
+		view.WeekName = i18n.Weekname(lang, d.Week)
 	}
-	return
+	if !d.WorksAs.IsZero() {
+		view.WorksAsDate = shortDate(d.WorksAs)
+		view.WorksAsWeekday = i18n.Weekday(lang, common.WeekdayToISO(d.WorksAs.Weekday()))
+	}
+	return render(f, lang, TemplateDay, view)
+}
+
+func (lr Lecturer) Name() string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s %s", lr.SecondName, lr.FirstName, lr.MiddleName))
 }
 
 func (gr GrouplistResponse) InlineButtons() (buttons tg.InlineKeyboardMarkup) {
@@ -235,8 +274,7 @@ func (gr GrouplistResponse) InlineButtons() (buttons tg.InlineKeyboardMarkup) {
 	return
 }
 
-func (gl GrouplistGroupList) InlineButtons(messageId int) (buttons tg.InlineKeyboardMarkup) {
-	fmt.Println(len(gl))
+func (gl GrouplistGroupList) InlineButtons(messageId int, lang i18n.Lang) (buttons tg.InlineKeyboardMarkup) {
 	buttons.InlineKeyboard = make(
 		[][]tg.InlineKeyboardButton,
 		int(math.Ceil(float64(len(gl)) / 3)),
@@ -257,27 +295,68 @@ func (gl GrouplistGroupList) InlineButtons(messageId int) (buttons tg.InlineKeyb
 	}
 	buttons.InlineKeyboard = append(buttons.InlineKeyboard, []tg.InlineKeyboardButton{
 		{
-			Text: "Назад",
+			Text: i18n.T(lang, i18n.ButtonBack),
 			CallbackData: common.CallbackData{ Typ: common.CallbackQueryTypeChangeInstitute, MessageId: messageId }.ToJson(),
 		},
 	})
 	return
 }
 
-func simpleGet[T any](url string) (output T, err error) {
-	res, err := common.Req(http.MethodGet, url, nil);
+var (
+	upstreamDuration = metrics.Default.Histogram("schedule_upstream_duration_seconds", "Time spent on requests to the schedule API, by endpoint.", metrics.DefBuckets, "endpoint")
+	upstreamFailures = metrics.Default.Counter("schedule_upstream_failures_total", "Failed requests to the schedule API, by endpoint.", "endpoint")
+)
+
+// The outcome of the latest request to the schedule API
+var lastRequest struct {
+	mu sync.Mutex
+	at time.Time
+	err error
+}
+
+// Reachable reports how the latest request to the schedule API went, and
+// when. Only if it is older than maxAge a new request is made.
+func Reachable(ctx context.Context, maxAge time.Duration) (at time.Time, err error) {
+	lastRequest.mu.Lock()
+	at, err = lastRequest.at, lastRequest.err
+	lastRequest.mu.Unlock()
+	if time.Since(at) < maxAge {
+		return
+	}
+	_, err = GetGrouplist(ctx)
+	return time.Now(), err
+}
+
+// simpleGet fetches and decodes url, endpoint names it in metrics
+func simpleGet[T any](ctx context.Context, endpoint string, url string) (output T, err error) {
+	start := time.Now()
+	defer func() {
+		upstreamDuration.Observe(time.Since(start).Seconds(), endpoint)
+		if err != nil {
+			upstreamFailures.Inc(endpoint)
+		}
+		// Our own cancellations say nothing about the API
+		if ctx.Err() != nil {
+			return
+		}
+		lastRequest.mu.Lock()
+		lastRequest.at, lastRequest.err = time.Now(), err
+		lastRequest.mu.Unlock()
+	}()
+	res, err := common.Req(ctx, http.MethodGet, url, nil);
 	if err != nil {
 		return
 	}
+	defer res.Body.Close()
 	err = json.NewDecoder(res.Body).Decode(&output)
 	return
 }
 
-func GetGrouplist() (GrouplistResponse, error) {
-	return simpleGet[GrouplistResponse](EndpointGrouplist)
+func GetGrouplist(ctx context.Context) (GrouplistResponse, error) {
+	return simpleGet[GrouplistResponse](ctx, "grouplist", Base + "/grouplist")
 }
 
-func GetGroup(id int) (GroupResponse, error) {
-	return simpleGet[GroupResponse](common.Concat(Endpoint, id))
+func GetGroup(ctx context.Context, id int) (GroupResponse, error) {
+	return simpleGet[GroupResponse](ctx, "group", common.Concat(Base + "/rasp/?group_id=", id))
 }
 
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"time"
+	"strings"
+	"testing"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+	"github.com/sergeykochiev/ivgpu-schedule/i18n"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+)
+
+func TestMain(m *testing.M) {
+	// Dates must not depend on the timezone of the machine running tests
+	time.Local = time.UTC
+	common.SetLocation(common.DefaultTimezone)
+	m.Run()
+}
+
+// at is h:m on date in the university timezone
+func at(date string, h int, m int) time.Time {
+	return totime(date).Add(time.Duration(h) * time.Hour + time.Duration(m) * time.Minute)
+}
+
+func titles(lessons LessonsOnPeriod) (t []string) {
+	for _, l := range(lessons) {
+		t = append(t, l.LessonTitle)
+	}
+	return
+}
+
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range(a) {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// autumn is a regular period starting on Monday 2025-09-01 with a first
+// week, Monday lessons on both parities and one limited to its date
+var autumn = GroupResponse{
+	Schedule: []GroupSchedule{
+		{
+			EduForm: EduFormOch,
+			StartDate: "2025-09-01",
+			EndDate: "2025-12-31",
+			WeekStart: WeekFirst,
+			LessonsOnPeriod: LessonsOnPeriod{
+				{ LessonTitle: "Weekly first", WeekDay: 0, Week: WeekFirst, LessonTime: LessonTimeFirst },
+				{ LessonTitle: "Dated", WeekDay: 0, Week: WeekFirst, LessonTime: LessonTimeSecond, Dates: []string{ "2025-09-01" } },
+				{ LessonTitle: "Weekly second", WeekDay: 0, Week: WeekSecond, LessonTime: LessonTimeFirst },
+			},
+		},
+	},
+}
+
+func TestDayDatedLessons(t *testing.T) {
+	tests := []struct {
+		name string
+		date string
+		userWeek int
+		want []string
+	}{
+		{ "on its date", "2025-09-01", 0, []string{ "Weekly first", "Dated" } },
+		{ "same parity later", "2025-09-15", 0, []string{ "Weekly first" } },
+		{ "other parity", "2025-09-08", 0, []string{ "Weekly second" } },
+		{ "pinned parity shows the pattern", "2025-09-15", WeekFirst, []string{ "Weekly first", "Dated" } },
+		{ "pinned other parity", "2025-09-15", WeekSecond, []string{ "Weekly second" } },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			got := titles(autumn.Day(at(tt.date, 12, 0), tt.userWeek).Lessons)
+			if !equal(got, tt.want) {
+				t.Errorf("Day(%s, %d) = %v, want %v", tt.date, tt.userWeek, got, tt.want)
+			}
+		})
+	}
+}
+
+// 2025-11-01 is a Saturday working as Monday 3.11, it is in week 9 (first)
+// while 3.11 starts week 10 (second)
+func TestDayTransferredParity(t *testing.T) {
+	d := autumn.Day(at("2025-11-01", 12, 0), 0)
+	if d.Week != WeekFirst {
+		t.Errorf("Week = %d, want %d", d.Week, WeekFirst)
+	}
+	if got, want := titles(d.Lessons), []string{ "Weekly first" }; !equal(got, want) {
+		t.Errorf("Lessons = %v, want %v", got, want)
+	}
+	text, err := autumn.ByDate(tg.HTML, i18n.RU, at("2025-11-01", 12, 0), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range([]string{ "Первая", "Weekly first" }) {
+		if !strings.Contains(text, want) {
+			t.Errorf("ByDate misses %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "Weekly second") {
+		t.Errorf("ByDate lists the other parity:\n%s", text)
+	}
+}
+
+// The server runs in UTC, three hours behind Moscow: right after midnight
+// in Moscow it is still the previous day in UTC.
+func TestDayAroundMidnight(t *testing.T) {
+	tests := []struct {
+		name string
+		utc time.Time
+		date string
+		weekday string
+		lessons []string
+	}{
+		{ "sunday 23:59", time.Date(2025, 9, 7, 20, 59, 0, 0, time.UTC), "7.9", "Воскресенье", nil },
+		{ "monday 00:01, week 2", time.Date(2025, 9, 7, 21, 1, 0, 0, time.UTC), "8.9", "Понедельник", []string{ "Weekly second" } },
+		{ "sunday 23:59, week 2", time.Date(2025, 9, 14, 20, 59, 0, 0, time.UTC), "14.9", "Воскресенье", nil },
+		{ "monday 00:01, week 3", time.Date(2025, 9, 14, 21, 1, 0, 0, time.UTC), "15.9", "Понедельник", []string{ "Weekly first" } },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			now := common.FixedClock{ T: tt.utc }.Now()
+			d := autumn.Day(now, 0)
+			if got := titles(d.Lessons); !equal(got, tt.lessons) {
+				t.Errorf("Day lessons = %v, want %v", got, tt.lessons)
+			}
+			// Day must not rely on the clock having converted the time
+			if got := titles(autumn.Day(tt.utc, 0).Lessons); !equal(got, tt.lessons) {
+				t.Errorf("Day lessons from UTC = %v, want %v", got, tt.lessons)
+			}
+			text, err := autumn.ByDate(tg.HTML, i18n.RU, now, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range(append([]string{ tt.date, tt.weekday }, tt.lessons...)) {
+				if !strings.Contains(text, want) {
+					t.Errorf("ByDate misses %q:\n%s", want, text)
+				}
+			}
+		})
+	}
+}
+
+// Titles, names and rooms come from upstream as is
+func TestByDateEscapes(t *testing.T) {
+	gr := GroupResponse{
+		LessonTimes: Timetable{ LessonTimeFirst: TimeRange{ Start: 8 * time.Hour, End: 9 * time.Hour + 30 * time.Minute } },
+		Schedule: []GroupSchedule{{
+			EduForm: EduFormOch,
+			StartDate: "2025-09-01",
+			EndDate: "2025-12-31",
+			WeekStart: WeekFirst,
+			LessonsOnPeriod: LessonsOnPeriod{{
+				LessonTitle: `Теория <графов> & "сети" (ч.1)`,
+				Lecturers: []Lecturer{{ SecondName: "O'Brien", FirstName: "<J>", MiddleName: "Jr_" }},
+				Room: []string{ "А&Б-1" },
+				WeekDay: 0,
+				Week: WeekFirst,
+				LessonTime: LessonTimeFirst,
+			}},
+		}},
+	}
+	tests := []struct {
+		f tg.Formatter
+		want []string
+		raw []string
+	}{
+		{ tg.HTML, []string{ "Теория &lt;графов&gt; &amp; &#34;сети&#34; (ч.1)", "O&#39;Brien &lt;J&gt; Jr_", "А&amp;Б-1", "8:00-9:30" }, []string{ "<графов>", "<J>", "А&Б" } },
+		{ tg.MarkdownV2, []string{ `Теория <графов\> & "сети" \(ч\.1\)`, `O'Brien <J\> Jr\_`, "`А&Б-1`", `1\.9`, `8:00\-9:30` }, []string{ "(ч.1)", "Jr_ " } },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.f.ParseMode(), func(t *testing.T) {
+			text, err := gr.ByDate(tt.f, i18n.RU, at("2025-09-01", 12, 0), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range(tt.want) {
+				if !strings.Contains(text, want) {
+					t.Errorf("misses %q:\n%s", want, text)
+				}
+			}
+			for _, raw := range(tt.raw) {
+				if strings.Contains(text, raw) {
+					t.Errorf("has %q unescaped:\n%s", raw, text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"fmt"
+	"time"
+	"slices"
+	"strings"
+	"hash/fnv"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+	"github.com/sergeykochiev/ivgpu-schedule/i18n"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+)
+
+type ExamKind string
+
+const (
+	ExamKindExam ExamKind = "exam"
+	ExamKindConsultation ExamKind = "consultation"
+)
+
+// Reminders go out the evening before an event and the morning of it
+const (
+	ReminderEvening = 19 * time.Hour
+	ReminderMorning = 7 * time.Hour
+)
+
+type ReminderSlot string
+
+const (
+	ReminderSlotEvening ReminderSlot = "evening"
+	ReminderSlotMorning ReminderSlot = "morning"
+)
+
+// ExamEvent is a single exam or consultation on a single date, an entry
+// of the exam period held on several dates gives several events.
+type ExamEvent struct {
+	Kind ExamKind
+	Date time.Time
+	// Zero when the timetable has no range for the lesson number
+	Start time.Time
+	// The timetable in effect on Date, the short one before holidays
+	Times Timetable
+	Lesson LessonOnPeriod
+}
+
+func (l LessonOnPeriod) ExamKind() ExamKind {
+	form := strings.ToLower(l.Form)
+	if strings.HasPrefix(form, "конс") || strings.HasPrefix(form, "cons") {
+		return ExamKindConsultation
+	}
+	return ExamKindExam
+}
+
+// Key identifies the event among every group's events, it survives
+// restarts and upstream reordering. The subject goes in hashed, for the
+// key to fit SentReminders.Event however long the title is.
+func (e ExamEvent) Key(groupId int) string {
+	subject := fnv.New64a()
+	subject.Write([]byte(strings.ToLower(strings.TrimSpace(e.Lesson.LessonTitle))))
+	return fmt.Sprintf("%s/%d/%s/%d/%x", fromtime(e.Date), e.Lesson.LessonTime, e.Kind, groupId, subject.Sum64())
+}
+
+// Events expands the period's entries into dated events, sorted by date
+// and time, timesOn giving the timetable of each date. Entries without
+// dates are skipped, there is nothing to count down to.
+func (gs GroupSchedule) Events(timesOn func(time.Time) Timetable) (events []ExamEvent) {
+	for _, lesson := range(gs.LessonsOnPeriod) {
+		for _, date := range(lesson.Dates) {
+			day := totime(date)
+			if day.IsZero() {
+				continue
+			}
+			e := ExamEvent{ Kind: lesson.ExamKind(), Date: day, Times: timesOn(day), Lesson: lesson }
+			if r, ok := e.Times.Range(lesson.LessonTime); ok {
+				e.Start, _ = r.On(day)
+			}
+			events = append(events, e)
+		}
+	}
+	slices.SortStableFunc(events, func(a, b ExamEvent) int {
+		if c := a.Date.Compare(b.Date); c != 0 {
+			return c
+		}
+		return a.Lesson.LessonTime - b.Lesson.LessonTime
+	})
+	return
+}
+
+// ExamEvents are the events of the exam period relevant at t
+func (gr GroupResponse) ExamEvents(t time.Time) []ExamEvent {
+	schedule, ok := gr.ExamSchedule(t)
+	if !ok {
+		return nil
+	}
+	return schedule.Events(gr.TimesOn)
+}
+
+// NextExam is the first exam, consultations aside, held on t's date or
+// later
+func (gr GroupResponse) NextExam(t time.Time) (ExamEvent, bool) {
+	today := common.StartOfDay(t)
+	for _, e := range(gr.ExamEvents(t)) {
+		if e.Kind == ExamKindExam && !e.Date.Before(today) {
+			return e, true
+		}
+	}
+	return ExamEvent{}, false
+}
+
+// DaysLeft counts calendar days from t to the event
+func (e ExamEvent) DaysLeft(t time.Time) int {
+	return daysBetween(t, e.Date)
+}
+
+func (e ExamEvent) View(rd RemoteDesc, lang i18n.Lang) (v LessonView) {
+	v = e.Lesson.View(e.Times, rd)
+	v.Date = shortDate(e.Date)
+	v.Weekday = i18n.Weekday(lang, common.WeekdayToISO(e.Date.Weekday()))
+	return
+}
+
+// ReminderAt is when the reminder of the slot is due
+func (e ExamEvent) ReminderAt(slot ReminderSlot) time.Time {
+	if slot == ReminderSlotEvening {
+		return e.Date.AddDate(0, 0, -1).Add(ReminderEvening)
+	}
+	return e.Date.Add(ReminderMorning)
+}
+
+// ReminderDue is true from the moment the reminder is due until it stops
+// making sense: the evening one until the day of the event, the morning
+// one until the event starts.
+func (e ExamEvent) ReminderDue(slot ReminderSlot, t time.Time) bool {
+	if t.Before(e.ReminderAt(slot)) {
+		return false
+	}
+	if slot == ReminderSlotEvening {
+		return t.Before(e.Date)
+	}
+	if !e.Start.IsZero() {
+		return t.Before(e.Start)
+	}
+	return t.Before(e.Date.AddDate(0, 0, 1))
+}
+
+// ExamGroup is an exam with the consultations held for it, or a lone
+// consultation
+type ExamGroup []ExamEvent
+
+// Last is the exam itself, consultations come before it
+func (g ExamGroup) Last() ExamEvent {
+	return g[len(g) - 1]
+}
+
+func sameSubject(a LessonOnPeriod, b LessonOnPeriod) bool {
+	return strings.EqualFold(strings.TrimSpace(a.LessonTitle), strings.TrimSpace(b.LessonTitle))
+}
+
+// GroupEvents pairs consultations with the first exam on the same subject
+// held after them. events must be sorted, as Events returns them.
+func GroupEvents(events []ExamEvent) (groups []ExamGroup) {
+	paired := make([]bool, len(events))
+	for i, e := range(events) {
+		if e.Kind != ExamKindExam {
+			continue
+		}
+		var g ExamGroup
+		for j, c := range(events[:i]) {
+			if !paired[j] && c.Kind == ExamKindConsultation && sameSubject(c.Lesson, e.Lesson) {
+				g = append(g, c)
+				paired[j] = true
+			}
+		}
+		paired[i] = true
+		groups = append(groups, append(g, e))
+	}
+	for j, c := range(events) {
+		if !paired[j] {
+			groups = append(groups, ExamGroup{ c })
+		}
+	}
+	slices.SortStableFunc(groups, func(a, b ExamGroup) int {
+		if c := a.Last().Date.Compare(b.Last().Date); c != 0 {
+			return c
+		}
+		return a.Last().Lesson.LessonTime - b.Last().Lesson.LessonTime
+	})
+	return
+}
+
+func (gr GroupResponse) Exams(f tg.Formatter, lang i18n.Lang, t time.Time) (string, error) {
+	schedule, ok := gr.ExamSchedule(t)
+	view := ExamsView{ Missing: !ok }
+	today := common.StartOfDay(t)
+	for _, g := range(GroupEvents(schedule.Events(gr.TimesOn))) {
+		gv := ExamGroupView{ Past: g.Last().Date.Before(today) }
+		for _, e := range(g) {
+			gv.Lessons = append(gv.Lessons, e.View(gr.RemoteDesc, lang))
+		}
+		view.Groups = append(view.Groups, gv)
+	}
+	for _, l := range(schedule.LessonsOnPeriod) {
+		if len(l.Dates) == 0 {
+			view.Undated = append(view.Undated, l.View(gr.LessonTimes, gr.RemoteDesc))
+		}
+	}
+	if next, ok := gr.NextExam(t); ok {
+		view.Countdown = countdown(lang, next, t)
+	}
+	return render(f, lang, TemplateExams, view)
+}
+
+func (gr GroupResponse) Reminder(f tg.Formatter, lang i18n.Lang, e ExamEvent, slot ReminderSlot) (string, error) {
+	return render(f, lang, TemplateReminder, ReminderView{
+		Heading: fmt.Sprintf("reminder.%s_%s", e.Kind, slot),
+		Lesson: e.View(gr.RemoteDesc, lang),
+	})
+}
+
+func countdown(lang i18n.Lang, e ExamEvent, t time.Time) string {
+	days := e.DaysLeft(t)
+	switch (days) {
+	case 0:
+		return i18n.T(lang, i18n.ExamsToday, e.Lesson.LessonTitle)
+	case 1:
+		return i18n.T(lang, i18n.ExamsTomorrow, e.Lesson.LessonTitle)
+	}
+	return i18n.T(lang, i18n.ExamsCountdown, e.Lesson.LessonTitle, i18n.Plural(lang, i18n.Days, days))
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"fmt"
+	"time"
+	"strings"
+	"testing"
+	"github.com/sergeykochiev/ivgpu-schedule/i18n"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+)
+
+func hm(h int, m int) time.Duration {
+	return time.Duration(h) * time.Hour + time.Duration(m) * time.Minute
+}
+
+// 2026-06-11 is a short pre-holiday day in the production calendar,
+// 2026-06-15 a regular one
+var summerSession = GroupResponse{
+	LessonTimes: Timetable{ LessonTimeSecond: { hm(9, 40), hm(11, 10) } },
+	LessonShortTimes: Timetable{ LessonTimeSecond: { hm(9, 20), hm(10, 40) } },
+	Schedule: []GroupSchedule{
+		{
+			EduForm: EduFormExamOch,
+			StartDate: "2026-06-08",
+			EndDate: "2026-06-30",
+			LessonsOnPeriod: LessonsOnPeriod{
+				{ LessonTitle: "Physics", Form: "Экзамен", LessonTime: LessonTimeSecond, Dates: []string{ "2026-06-11" } },
+				{ LessonTitle: "Maths", Form: "Экзамен", LessonTime: LessonTimeSecond, Dates: []string{ "2026-06-15" } },
+			},
+		},
+	},
+}
+
+func TestExamEventsShortDay(t *testing.T) {
+	events := summerSession.ExamEvents(at("2026-06-01", 12, 0))
+	if len(events) != 2 {
+		t.Fatalf("%d events, want 2", len(events))
+	}
+	tests := []struct {
+		event ExamEvent
+		start time.Time
+	}{
+		{ events[0], at("2026-06-11", 9, 20) },
+		{ events[1], at("2026-06-15", 9, 40) },
+	}
+	for _, tt := range(tests) {
+		if !tt.event.Start.Equal(tt.start) {
+			t.Errorf("%s starts at %s, want %s", tt.event.Lesson.LessonTitle, tt.event.Start, tt.start)
+		}
+	}
+	// The morning reminder stops making sense once the exam has started
+	if !events[0].ReminderDue(ReminderSlotMorning, at("2026-06-11", 9, 10)) {
+		t.Error("morning reminder not due before the short day start")
+	}
+	if events[0].ReminderDue(ReminderSlotMorning, at("2026-06-11", 9, 30)) {
+		t.Error("morning reminder due after the short day start")
+	}
+}
+
+func TestExamsViewShortDay(t *testing.T) {
+	text, err := summerSession.Exams(tg.HTML, i18n.RU, at("2026-06-01", 12, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range([]string{ "9:20-10:40", "9:40-11:10" }) {
+		if !strings.Contains(text, want) {
+			t.Errorf("Exams misses %q:\n%s", want, text)
+		}
+	}
+	reminder, err := summerSession.Reminder(tg.HTML, i18n.RU, summerSession.ExamEvents(at("2026-06-01", 12, 0))[0], ReminderSlotEvening)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(reminder, "9:20-10:40") {
+		t.Errorf("Reminder misses the short timetable:\n%s", reminder)
+	}
+}
+
+func exam(title string, form string, dates ...string) LessonOnPeriod {
+	return LessonOnPeriod{ LessonTitle: title, Form: form, LessonTime: LessonTimeSecond, Dates: dates }
+}
+
+func TestGroupEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		lessons LessonsOnPeriod
+		want [][]string
+	}{
+		{
+			"consultation before its exam",
+			LessonsOnPeriod{
+				exam("Physics", "Экзамен", "2026-06-15"),
+				exam("Physics", "Консультация", "2026-06-13"),
+			},
+			[][]string{ { "Physics consultation 2026-06-13", "Physics exam 2026-06-15" } },
+		},
+		{
+			"paired with the next exam of the subject only",
+			LessonsOnPeriod{
+				exam("Maths", "Экзамен", "2026-06-10"),
+				exam("Physics", "Консультация", "2026-06-12"),
+				exam("physics ", "Экзамен", "2026-06-15"),
+				exam("Maths", "Консультация", "2026-06-19"),
+				exam("Maths", "Экзамен", "2026-06-20"),
+			},
+			[][]string{
+				{ "Maths exam 2026-06-10" },
+				{ "Physics consultation 2026-06-12", "physics  exam 2026-06-15" },
+				{ "Maths consultation 2026-06-19", "Maths exam 2026-06-20" },
+			},
+		},
+		{
+			"lone consultation",
+			LessonsOnPeriod{
+				exam("Chemistry", "Консультация", "2026-06-12"),
+				exam("Physics", "Экзамен", "2026-06-10"),
+			},
+			[][]string{ { "Physics exam 2026-06-10" }, { "Chemistry consultation 2026-06-12" } },
+		},
+		{
+			"consultation after the exam",
+			LessonsOnPeriod{
+				exam("Physics", "Экзамен", "2026-06-10"),
+				exam("Physics", "Консультация", "2026-06-12"),
+			},
+			[][]string{ { "Physics exam 2026-06-10" }, { "Physics consultation 2026-06-12" } },
+		},
+		{
+			"entry held on several dates",
+			LessonsOnPeriod{
+				exam("Physics", "Консультация", "2026-06-09"),
+				exam("Physics", "Экзамен", "2026-06-10", "2026-06-17"),
+			},
+			[][]string{ { "Physics consultation 2026-06-09", "Physics exam 2026-06-10" }, { "Physics exam 2026-06-17" } },
+		},
+		{ "nothing dated", LessonsOnPeriod{ exam("Physics", "Экзамен") }, nil },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := GroupSchedule{ EduForm: EduFormExamOch, LessonsOnPeriod: tt.lessons }
+			var got [][]string
+			for _, g := range(GroupEvents(schedule.Events(summerSession.TimesOn))) {
+				var group []string
+				for _, e := range(g) {
+					group = append(group, fmt.Sprintf("%s %s %s", e.Lesson.LessonTitle, e.Kind, fromtime(e.Date)))
+				}
+				got = append(got, group)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExamsViewMarksPast(t *testing.T) {
+	gr := summerSession
+	gr.Schedule = []GroupSchedule{{
+		EduForm: EduFormExamOch,
+		StartDate: "2026-06-08",
+		EndDate: "2026-06-30",
+		LessonsOnPeriod: LessonsOnPeriod{
+			exam("Physics", "Консультация", "2026-06-09"),
+			exam("Physics", "Экзамен", "2026-06-10"),
+			// The consultation is past, the exam it belongs to isn't
+			exam("Maths", "Консультация", "2026-06-12"),
+			exam("Maths", "Экзамен", "2026-06-15"),
+		},
+	}}
+	text, err := gr.Exams(tg.HTML, i18n.EN, at("2026-06-13", 12, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := i18n.T(i18n.EN, i18n.ExamsPast)
+	before, after, ok := strings.Cut(text, past)
+	if !ok || strings.Count(text, past) != 1 {
+		t.Fatalf("want a single %q mark:\n%s", past, text)
+	}
+	if strings.Contains(before, "Physics") || strings.Count(after, "Physics") != 2 {
+		t.Errorf("Physics is not marked past:\n%s", text)
+	}
+	if maths, _, _ := strings.Cut(after, "Maths"); !strings.Contains(maths, "Physics") {
+		t.Errorf("Maths is marked past:\n%s", text)
+	}
+}
+
+func TestExamEventKey(t *testing.T) {
+	events := func(lessons ...LessonOnPeriod) []ExamEvent {
+		return GroupSchedule{ EduForm: EduFormExamOch, LessonsOnPeriod: lessons }.Events(summerSession.TimesOn)
+	}
+	physics := events(exam("Physics", "Экзамен", "2026-06-15"))[0]
+	tests := []struct {
+		name string
+		event ExamEvent
+		groupId int
+		same bool
+	}{
+		{ "same event", physics, 42, true },
+		{ "title spelled differently", events(exam(" physics", "Экзамен", "2026-06-15"))[0], 42, true },
+		{ "listed after another", events(exam("Maths", "Экзамен", "2026-06-10"), exam("Physics", "Экзамен", "2026-06-15"))[1], 42, true },
+		{ "other group", physics, 43, false },
+		{ "other subject at the same time", events(exam("Maths", "Экзамен", "2026-06-15"))[0], 42, false },
+		{ "consultation", events(exam("Physics", "Консультация", "2026-06-15"))[0], 42, false },
+		{ "other date", events(exam("Physics", "Экзамен", "2026-06-16"))[0], 42, false },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := tt.event.Key(tt.groupId) == physics.Key(42); same != tt.same {
+				t.Errorf("%q == %q is %t, want %t", tt.event.Key(tt.groupId), physics.Key(42), same, tt.same)
+			}
+		})
+	}
+	long := events(exam(strings.Repeat("Теория вероятностей и математическая статистика ", 5), "Консультация", "2026-06-15"))[0]
+	if key := long.Key(2147483647); len([]rune(key)) > 64 {
+		t.Errorf("%q doesn't fit SentReminders.Event", key)
+	}
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"fmt"
+	"time"
+	"sort"
+	"errors"
+	"regexp"
+	"strconv"
+	"encoding/json"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+	"github.com/sergeykochiev/ivgpu-schedule/calendar"
+)
+
+// TimeRange is a span of a day, both ends as offsets from midnight
+type TimeRange struct {
+	Start time.Duration
+	End time.Duration
+}
+
+// Timetable maps a pair number (LessonOnPeriod.LessonTime) to its time.
+// Upstream sends it as {"0": "8:00-9:30", ...}, keyed by stringified ints,
+// with "-1" (LessonTimeAll) spanning the whole day.
+type Timetable map[int]TimeRange
+
+var clockRe = regexp.MustCompile(`(\d{1,2})[:.](\d{2})`)
+
+// ParseTimeRange accepts the upstream "8:00-9:30" form, tolerating spaces,
+// dashes of any kind and dots instead of colons.
+func ParseTimeRange(s string) (r TimeRange, err error) {
+	m := clockRe.FindAllStringSubmatch(s, -1)
+	if len(m) != 2 {
+		err = errors.Join(common.ErrParseLessonTime, fmt.Errorf("%q", s))
+		return
+	}
+	bounds := [2]time.Duration{}
+	for i, hm := range(m) {
+		h, _ := strconv.Atoi(hm[1])
+		min, _ := strconv.Atoi(hm[2])
+		if h > 23 || min > 59 {
+			err = errors.Join(common.ErrParseLessonTime, fmt.Errorf("%q", s))
+			return
+		}
+		bounds[i] = time.Duration(h) * time.Hour + time.Duration(min) * time.Minute
+	}
+	r = TimeRange{ Start: bounds[0], End: bounds[1] }
+	if r.End <= r.Start {
+		err = errors.Join(common.ErrParseLessonTime, fmt.Errorf("%q ends before it starts", s))
+	}
+	return
+}
+
+func clock(d time.Duration) string {
+	return fmt.Sprintf("%d:%02d", int(d.Hours()), int(d.Minutes()) % 60)
+}
+
+func (r TimeRange) String() string {
+	return clock(r.Start) + "-" + clock(r.End)
+}
+
+// On anchors the range to the date of day
+func (r TimeRange) On(day time.Time) (start time.Time, end time.Time) {
+	day = common.StartOfDay(day)
+	return day.Add(r.Start), day.Add(r.End)
+}
+
+func (r TimeRange) Contains(d time.Duration) bool {
+	return d >= r.Start && d < r.End
+}
+
+// ParseTimetable keeps every valid entry and reports the invalid ones, so
+// that one malformed pair doesn't take the whole schedule down.
+func ParseTimetable(raw map[string]string) (tt Timetable, err error) {
+	tt = make(Timetable, len(raw))
+	var errs []error
+	for k, v := range(raw) {
+		n, convErr := strconv.Atoi(k)
+		if convErr != nil {
+			errs = append(errs, errors.Join(common.ErrParseLessonTime, fmt.Errorf("pair %q", k)))
+			continue
+		}
+		r, parseErr := ParseTimeRange(v)
+		if parseErr != nil {
+			errs = append(errs, parseErr)
+			continue
+		}
+		tt[n] = r
+	}
+	err = errors.Join(errs...)
+	return
+}
+
+// UnmarshalJSON drops malformed entries. GroupResponse keeps their errors
+// for Validate, lessons referring to them are reported there as well.
+func (tt *Timetable) UnmarshalJSON(b []byte) error {
+	var raw map[string]string
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*tt, _ = ParseTimetable(raw)
+	return nil
+}
+
+func (tt Timetable) MarshalJSON() ([]byte, error) {
+	raw := make(map[string]string, len(tt))
+	for n, r := range(tt) {
+		raw[strconv.Itoa(n)] = r.String()
+	}
+	return json.Marshal(raw)
+}
+
+// Pairs lists pair numbers in order, without LessonTimeAll
+func (tt Timetable) Pairs() (pairs []int) {
+	for n := range(tt) {
+		if n != LessonTimeAll {
+			pairs = append(pairs, n)
+		}
+	}
+	sort.Ints(pairs)
+	return
+}
+
+func (tt Timetable) Range(lessonTime int) (TimeRange, bool) {
+	r, ok := tt[lessonTime]
+	return r, ok
+}
+
+// Validate checks that pairs follow each other without overlapping
+func (tt Timetable) Validate() error {
+	var errs []error
+	pairs := tt.Pairs()
+	for i := 1; i < len(pairs); i++ {
+		prev, cur := tt[pairs[i - 1]], tt[pairs[i]]
+		if cur.Start < prev.End {
+			errs = append(errs, errors.Join(
+				common.ErrInvalidTimetable,
+				fmt.Errorf("pair %d (%s) overlaps pair %d (%s)", pairs[i], cur, pairs[i - 1], prev),
+			))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// At finds the pair in progress at the given offset from midnight
+func (tt Timetable) At(d time.Duration) (int, bool) {
+	for _, n := range(tt.Pairs()) {
+		if tt[n].Contains(d) {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// Validate reports problems with the timetables, periods and lessons. The
+// schedule stays usable either way, broken entries are just never shown.
+func (gr GroupResponse) Validate() error {
+	errs := []error{ gr.timesErr }
+	if err := gr.LessonTimes.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := gr.LessonShortTimes.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	invalid := func(format string, args ...any) {
+		errs = append(errs, errors.Join(common.ErrInvalidSchedule, fmt.Errorf(format, args...)))
+	}
+	for _, schedule := range(gr.Schedule) {
+		switch {
+		case schedule.Start().IsZero() || schedule.End().IsZero():
+			invalid("%q has invalid dates %q - %q", schedule.Title, schedule.StartDate, schedule.EndDate)
+		case schedule.End().Before(schedule.Start()):
+			invalid("%q ends before it starts", schedule.Title)
+		}
+		for _, l := range(schedule.LessonsOnPeriod) {
+			if _, ok := gr.LessonTimes.Range(l.LessonTime); !ok {
+				invalid("%q in %q has no time for pair %d", l.LessonTitle, schedule.Title, l.LessonTime)
+			}
+			if l.WeekDay < 0 || l.WeekDay > 6 {
+				invalid("%q in %q has invalid weekday %d", l.LessonTitle, schedule.Title, l.WeekDay)
+			}
+			if l.Week < 0 || l.Week > WeekSecond {
+				invalid("%q in %q has invalid week %d", l.LessonTitle, schedule.Title, l.Week)
+			}
+			for _, date := range(l.Dates) {
+				if totime(date).IsZero() {
+					invalid("%q in %q has invalid date %q", l.LessonTitle, schedule.Title, date)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Times picks the timetable for a day, short days have their own one
+// when upstream provides it.
+func (gr GroupResponse) Times(short bool) Timetable {
+	if short && len(gr.LessonShortTimes) > 0 {
+		return gr.LessonShortTimes
+	}
+	return gr.LessonTimes
+}
+
+// TimesOn is the timetable in effect on t's date
+func (gr GroupResponse) TimesOn(t time.Time) Timetable {
+	return gr.Times(calendar.Default.IsShort(t))
+}
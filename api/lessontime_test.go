@@ -0,0 +1,165 @@
+package api
+
+import (
+	"time"
+	"errors"
+	"testing"
+	"encoding/json"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+)
+
+func TestParseTimeRange(t *testing.T) {
+	tests := []struct {
+		in string
+		want TimeRange
+		ok bool
+	}{
+		{ "8:00-9:30", TimeRange{ hm(8, 0), hm(9, 30) }, true },
+		{ "08:00 - 09:30", TimeRange{ hm(8, 0), hm(9, 30) }, true },
+		{ "9.40–11.10", TimeRange{ hm(9, 40), hm(11, 10) }, true },
+		{ "13:20—14:50", TimeRange{ hm(13, 20), hm(14, 50) }, true },
+		{ "", TimeRange{}, false },
+		{ "8:00", TimeRange{}, false },
+		{ "8:00-9:30-11:00", TimeRange{}, false },
+		{ "8-9", TimeRange{}, false },
+		{ "8:0-9:30", TimeRange{}, false },
+		{ "24:00-25:30", TimeRange{}, false },
+		{ "8:60-9:30", TimeRange{}, false },
+		{ "9:30-8:00", TimeRange{}, false },
+		{ "9:30-9:30", TimeRange{}, false },
+		// Pairs never cross midnight, such a range is a typo upstream
+		{ "23:30-0:30", TimeRange{}, false },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.in, func(t *testing.T) {
+			r, err := ParseTimeRange(tt.in)
+			if !tt.ok {
+				if !errors.Is(err, common.ErrParseLessonTime) {
+					t.Errorf("err = %v, want ErrParseLessonTime", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r != tt.want {
+				t.Errorf("got %s, want %s", r, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimetable(t *testing.T) {
+	tt, err := ParseTimetable(map[string]string{
+		"-1": "8:00-20:00",
+		"0": "8:00-9:30",
+		"1": "9:40-11:10",
+		"2": "11:10",
+		"x": "13:00-14:30",
+	})
+	if !errors.Is(err, common.ErrParseLessonTime) {
+		t.Errorf("err = %v, want ErrParseLessonTime", err)
+	}
+	want := Timetable{
+		LessonTimeAll: { hm(8, 0), hm(20, 0) },
+		LessonTimeFirst: { hm(8, 0), hm(9, 30) },
+		LessonTimeSecond: { hm(9, 40), hm(11, 10) },
+	}
+	if len(tt) != len(want) {
+		t.Fatalf("got %v, want %v", tt, want)
+	}
+	for n, r := range(want) {
+		if tt[n] != r {
+			t.Errorf("pair %d = %s, want %s", n, tt[n], r)
+		}
+	}
+	if tt, err = ParseTimetable(nil); err != nil || len(tt) != 0 {
+		t.Errorf("empty: got %v, %v", tt, err)
+	}
+}
+
+func TestTimetableValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		tt Timetable
+		ok bool
+	}{
+		{ "empty", Timetable{}, true },
+		{ "nil", nil, true },
+		{ "one pair", Timetable{ 0: { hm(8, 0), hm(9, 30) } }, true },
+		{ "back to back", Timetable{ 0: { hm(8, 0), hm(9, 30) }, 1: { hm(9, 30), hm(11, 0) } }, true },
+		{ "whole day ignored", Timetable{ LessonTimeAll: { hm(8, 0), hm(20, 0) }, 0: { hm(8, 0), hm(9, 30) }, 1: { hm(9, 40), hm(11, 10) } }, true },
+		{ "overlapping", Timetable{ 0: { hm(8, 0), hm(9, 30) }, 1: { hm(9, 0), hm(10, 30) } }, false },
+		{ "out of order", Timetable{ 0: { hm(9, 40), hm(11, 10) }, 1: { hm(8, 0), hm(9, 30) } }, false },
+		{ "overlap past a gap", Timetable{ 0: { hm(8, 0), hm(9, 30) }, 2: { hm(9, 0), hm(10, 30) } }, false },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tt.Validate()
+			if tt.ok && err != nil {
+				t.Errorf("unexpected %v", err)
+			}
+			if !tt.ok && !errors.Is(err, common.ErrInvalidTimetable) {
+				t.Errorf("err = %v, want ErrInvalidTimetable", err)
+			}
+		})
+	}
+}
+
+func TestTimetableAt(t *testing.T) {
+	tt := Timetable{
+		LessonTimeAll: { hm(8, 0), hm(20, 0) },
+		LessonTimeFirst: { hm(8, 0), hm(9, 30) },
+		LessonTimeSecond: { hm(9, 40), hm(11, 10) },
+	}
+	tests := []struct {
+		at time.Duration
+		pair int
+		ok bool
+	}{
+		{ hm(7, 59), 0, false },
+		{ hm(8, 0), LessonTimeFirst, true },
+		{ hm(9, 29), LessonTimeFirst, true },
+		{ hm(9, 30), 0, false },
+		{ hm(9, 40), LessonTimeSecond, true },
+		{ hm(11, 10), 0, false },
+		{ hm(23, 59), 0, false },
+	}
+	for _, tc := range(tests) {
+		pair, ok := tt.At(tc.at)
+		if pair != tc.pair || ok != tc.ok {
+			t.Errorf("At(%s) = %d, %t, want %d, %t", clock(tc.at), pair, ok, tc.pair, tc.ok)
+		}
+	}
+	if _, ok := (Timetable{}).At(hm(9, 0)); ok {
+		t.Error("empty timetable has a pair in progress")
+	}
+}
+
+func TestGroupResponseKeepsTimetableErrors(t *testing.T) {
+	var gr GroupResponse
+	err := json.Unmarshal([]byte(`{
+		"lesson_times": { "0": "8:00-9:30", "1": "9:40 11:10", "2": "25:00-26:30" },
+		"lesson_short_times": { "0": "8:00-9:00", "1": "8:30-9:30" },
+		"rasp": []
+	}`), &gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gr.LessonTimes) != 2 || len(gr.LessonShortTimes) != 2 {
+		t.Errorf("got %v and %v", gr.LessonTimes, gr.LessonShortTimes)
+	}
+	err = gr.Validate()
+	if !errors.Is(err, common.ErrParseLessonTime) {
+		t.Errorf("err = %v, want ErrParseLessonTime", err)
+	}
+	if !errors.Is(err, common.ErrInvalidTimetable) {
+		t.Errorf("err = %v, want ErrInvalidTimetable", err)
+	}
+	if err = json.Unmarshal([]byte(`{ "rasp": [] }`), &gr); err != nil {
+		t.Fatal(err)
+	}
+	if err = gr.Validate(); err != nil {
+		t.Errorf("unexpected %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"time"
+	"github.com/sergeykochiev/ivgpu-schedule/i18n"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+)
+
+const TemplateNow = "now"
+
+// NowStatus is what is going on at a moment: the lessons in progress, if
+// any, and the next ones later the same day. Several lessons can share a
+// slot when subgroups are split.
+type NowStatus struct {
+	Times Timetable
+	Current LessonsOnPeriod
+	CurrentEnds time.Time
+	Next LessonsOnPeriod
+	NextStarts time.Time
+}
+
+type NowView struct {
+	Current []LessonView
+	MinutesLeft int
+	Next []LessonView
+	MinutesUntil int
+}
+
+func (gr GroupResponse) Now(t time.Time, userWeek int) (status NowStatus) {
+	d := gr.Day(t, userWeek)
+	status.Times = gr.Times(d.Short)
+	for _, l := range(d.Lessons) {
+		r, ok := status.Times.Range(l.LessonTime)
+		if !ok {
+			continue
+		}
+		start, end := r.On(d.Date)
+		switch {
+		case !t.Before(start) && t.Before(end):
+			status.Current = append(status.Current, l)
+			status.CurrentEnds = end
+		case start.After(t) && (status.Next == nil || start.Before(status.NextStarts)):
+			status.Next = LessonsOnPeriod{ l }
+			status.NextStarts = start
+		case start.After(t) && start.Equal(status.NextStarts):
+			status.Next = append(status.Next, l)
+		}
+	}
+	return
+}
+
+func minutesCeil(d time.Duration) int {
+	return int((d + time.Minute - 1) / time.Minute)
+}
+
+func (gr GroupResponse) NowReadable(f tg.Formatter, lang i18n.Lang, t time.Time, userWeek int) (string, error) {
+	status := gr.Now(t, userWeek)
+	view := NowView{
+		Current: status.Current.View(status.Times, gr.RemoteDesc),
+		Next: status.Next.View(status.Times, gr.RemoteDesc),
+	}
+	if len(status.Current) > 0 {
+		view.MinutesLeft = minutesCeil(status.CurrentEnds.Sub(t))
+	}
+	if len(status.Next) > 0 {
+		view.MinutesUntil = minutesCeil(status.NextStarts.Sub(t))
+	}
+	return render(f, lang, TemplateNow, view)
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"time"
+	"strings"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+)
+
+const (
+	EduFormOch = "och"
+	EduFormZaoch = "zaoch"
+	EduFormExamOch = "exam_och"
+	EduFormExamZaoch = "exam_zaoch"
+	examPrefix = "exam_"
+)
+
+type PeriodState int
+
+const (
+	PeriodActive PeriodState = iota
+	// No period contains the date, but one starts later
+	PeriodNotStarted
+	// Every period has ended by the date
+	PeriodFinished
+	// Upstream sent no periods at all
+	PeriodNone
+)
+
+func (gs GroupSchedule) IsExam() bool {
+	return strings.HasPrefix(gs.EduForm, examPrefix)
+}
+
+// Form is EduForm without the exam prefix, exam_zaoch belongs to zaoch
+func (gs GroupSchedule) Form() string {
+	return strings.TrimPrefix(gs.EduForm, examPrefix)
+}
+
+// Periods lists every period containing t, regular ones first, in
+// upstream order otherwise. Periods overlap during session, when the
+// semester is still running next to the exam period.
+func (gr GroupResponse) Periods(t time.Time) (regular []GroupSchedule, exam []GroupSchedule) {
+	for _, schedule := range(gr.Schedule) {
+		if !schedule.Contains(t) {
+			continue
+		}
+		if schedule.IsExam() {
+			exam = append(exam, schedule)
+		} else {
+			regular = append(regular, schedule)
+		}
+	}
+	return
+}
+
+// ScheduleAt finds the period containing t, preferring a regular one
+func (gr GroupResponse) ScheduleAt(t time.Time) (GroupSchedule, bool) {
+	regular, exam := gr.Periods(t)
+	switch {
+	case len(regular) > 0:
+		return regular[0], true
+	case len(exam) > 0:
+		return exam[0], true
+	}
+	return GroupSchedule{}, false
+}
+
+func (gr GroupResponse) PeriodState(t time.Time) PeriodState {
+	if len(gr.Schedule) == 0 {
+		return PeriodNone
+	}
+	if _, ok := gr.ScheduleAt(t); ok {
+		return PeriodActive
+	}
+	day := common.StartOfDay(t)
+	for _, schedule := range(gr.Schedule) {
+		if schedule.Start().After(day) {
+			return PeriodNotStarted
+		}
+	}
+	return PeriodFinished
+}
+
+// InSession is true while an exam period or a period flagged as session
+// contains t
+func (gr GroupResponse) InSession(t time.Time) bool {
+	regular, exam := gr.Periods(t)
+	if len(exam) > 0 {
+		return true
+	}
+	for _, schedule := range(regular) {
+		if schedule.Session {
+			return true
+		}
+	}
+	return false
+}
+
+// forms are the education forms of the group's regular periods
+func (gr GroupResponse) forms() (forms []string) {
+	for _, schedule := range(gr.Schedule) {
+		if !schedule.IsExam() {
+			forms = append(forms, schedule.Form())
+		}
+	}
+	return
+}
+
+// ExamSchedule picks the exam period relevant at t: the one running, else
+// the next one, else the last one to end. Periods of the group's own form
+// win over others. ok is false when upstream has no exam period at all.
+func (gr GroupResponse) ExamSchedule(t time.Time) (best GroupSchedule, ok bool) {
+	forms := gr.forms()
+	score := func(gs GroupSchedule) (s int) {
+		for _, form := range(forms) {
+			if form == gs.Form() {
+				s += 4
+				break
+			}
+		}
+		switch {
+		case gs.Contains(t):
+			s += 2
+		case gs.Start().After(t):
+			s += 1
+		}
+		return
+	}
+	for _, schedule := range(gr.Schedule) {
+		if !schedule.IsExam() {
+			continue
+		}
+		switch {
+		case !ok, score(schedule) > score(best):
+			best, ok = schedule, true
+		case score(schedule) == score(best) && schedule.Start().After(t) && schedule.Start().Before(best.Start()):
+			best = schedule
+		case score(schedule) == score(best) && !schedule.Start().After(t) && schedule.End().After(best.End()):
+			best = schedule
+		}
+	}
+	return
+}
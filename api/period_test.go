@@ -0,0 +1,154 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"github.com/sergeykochiev/ivgpu-schedule/i18n"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+)
+
+func titled(title string, form string, start string, end string) GroupSchedule {
+	return GroupSchedule{ Title: title, EduForm: form, StartDate: start, EndDate: end, WeekStart: WeekFirst }
+}
+
+var (
+	autumnOch = titled("autumn", EduFormOch, "2025-09-01", "2025-12-31")
+	springOch = titled("spring", EduFormOch, "2026-02-09", "2026-06-30")
+	autumnZaoch = titled("autumn zaoch", EduFormZaoch, "2025-09-01", "2025-12-31")
+	winterExamOch = titled("winter exams", EduFormExamOch, "2026-01-09", "2026-01-31")
+	// Overlaps the end of the autumn semester
+	winterExamZaoch = titled("winter exams zaoch", EduFormExamZaoch, "2025-12-15", "2026-01-20")
+	summerExamOch = titled("summer exams", EduFormExamOch, "2026-06-01", "2026-07-10")
+)
+
+func TestPeriodState(t *testing.T) {
+	year := GroupResponse{ Schedule: []GroupSchedule{ autumnOch, springOch } }
+	tests := []struct {
+		name string
+		gr GroupResponse
+		at string
+		hour int
+		want PeriodState
+	}{
+		{ "nothing published", GroupResponse{}, "2025-10-01", 12, PeriodNone },
+		{ "before the year", year, "2025-08-20", 12, PeriodNotStarted },
+		{ "eve of the first day", year, "2025-08-31", 23, PeriodNotStarted },
+		{ "first day", year, "2025-09-01", 0, PeriodActive },
+		{ "last day", year, "2025-12-31", 23, PeriodActive },
+		{ "between semesters", year, "2026-01-15", 12, PeriodNotStarted },
+		{ "after the year", year, "2026-07-01", 0, PeriodFinished },
+		{ "after the only semester", GroupResponse{ Schedule: []GroupSchedule{ autumnOch } }, "2026-01-01", 0, PeriodFinished },
+		{ "exam period only", GroupResponse{ Schedule: []GroupSchedule{ winterExamOch } }, "2026-01-10", 12, PeriodActive },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.gr.PeriodState(at(tt.at, tt.hour, 0)); got != tt.want {
+				t.Errorf("PeriodState = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleAtPrefersRegular(t *testing.T) {
+	gr := GroupResponse{ Schedule: []GroupSchedule{ winterExamZaoch, autumnZaoch } }
+	regular, exam := gr.Periods(at("2025-12-20", 12, 0))
+	if len(regular) != 1 || len(exam) != 1 {
+		t.Fatalf("got %d regular and %d exam periods, want one each", len(regular), len(exam))
+	}
+	if s, ok := gr.ScheduleAt(at("2025-12-20", 12, 0)); !ok || s.Title != autumnZaoch.Title {
+		t.Errorf("ScheduleAt = %q, %t, want %q", s.Title, ok, autumnZaoch.Title)
+	}
+	if s, ok := gr.ScheduleAt(at("2026-01-10", 12, 0)); !ok || s.Title != winterExamZaoch.Title {
+		t.Errorf("ScheduleAt = %q, %t, want %q", s.Title, ok, winterExamZaoch.Title)
+	}
+	if _, ok := gr.ScheduleAt(at("2026-02-01", 12, 0)); ok {
+		t.Error("ScheduleAt found a period after all of them")
+	}
+}
+
+func TestExamSchedule(t *testing.T) {
+	fullTime := GroupResponse{ Schedule: []GroupSchedule{ autumnOch, winterExamZaoch, winterExamOch } }
+	partTime := GroupResponse{ Schedule: []GroupSchedule{ autumnZaoch, winterExamOch, winterExamZaoch } }
+	examsOnly := GroupResponse{ Schedule: []GroupSchedule{ summerExamOch, winterExamOch } }
+	tests := []struct {
+		name string
+		gr GroupResponse
+		at string
+		want string
+	}{
+		{ "own form before both", fullTime, "2025-11-01", winterExamOch.Title },
+		{ "own form over a running one", fullTime, "2025-12-20", winterExamOch.Title },
+		{ "own form running", fullTime, "2026-01-10", winterExamOch.Title },
+		{ "own form after both", fullTime, "2026-03-01", winterExamOch.Title },
+		{ "part-time before both", partTime, "2025-11-01", winterExamZaoch.Title },
+		{ "part-time running", partTime, "2026-01-10", winterExamZaoch.Title },
+		{ "part-time ended, full-time running", partTime, "2026-01-25", winterExamZaoch.Title },
+		{ "nearest upcoming", examsOnly, "2025-11-01", winterExamOch.Title },
+		{ "running over upcoming", examsOnly, "2026-01-10", winterExamOch.Title },
+		{ "upcoming over ended", examsOnly, "2026-02-15", summerExamOch.Title },
+		{ "last to end", examsOnly, "2026-08-01", summerExamOch.Title },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ok := tt.gr.ExamSchedule(at(tt.at, 12, 0))
+			if !ok || s.Title != tt.want {
+				t.Errorf("ExamSchedule = %q, %t, want %q", s.Title, ok, tt.want)
+			}
+		})
+	}
+	if s, ok := (GroupResponse{ Schedule: []GroupSchedule{ autumnOch } }).ExamSchedule(at("2025-11-01", 12, 0)); ok {
+		t.Errorf("ExamSchedule = %q without exam periods", s.Title)
+	}
+}
+
+func TestInSession(t *testing.T) {
+	flagged := autumnOch
+	flagged.Session = true
+	tests := []struct {
+		name string
+		gr GroupResponse
+		at string
+		want bool
+	}{
+		{ "semester", GroupResponse{ Schedule: []GroupSchedule{ autumnZaoch, winterExamZaoch } }, "2025-11-01", false },
+		{ "exams overlapping the semester", GroupResponse{ Schedule: []GroupSchedule{ autumnZaoch, winterExamZaoch } }, "2025-12-20", true },
+		{ "exams only", GroupResponse{ Schedule: []GroupSchedule{ autumnZaoch, winterExamZaoch } }, "2026-01-10", true },
+		{ "between periods", GroupResponse{ Schedule: []GroupSchedule{ autumnOch, winterExamOch } }, "2026-01-05", false },
+		{ "flagged regular period", GroupResponse{ Schedule: []GroupSchedule{ flagged } }, "2025-11-01", true },
+		{ "nothing published", GroupResponse{}, "2025-11-01", false },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.gr.InSession(at(tt.at, 12, 0)); got != tt.want {
+				t.Errorf("InSession = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestByDatePeriodState(t *testing.T) {
+	year := GroupResponse{ Schedule: []GroupSchedule{ autumnOch, springOch } }
+	tests := []struct {
+		name string
+		gr GroupResponse
+		at string
+		want i18n.Key
+	}{
+		{ "nothing published", GroupResponse{}, "2025-10-01", i18n.ScheduleMissing },
+		{ "not started", year, "2025-08-20", i18n.ScheduleNotStarted },
+		{ "finished", year, "2026-07-01", i18n.ScheduleFinished },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, lang := range([]i18n.Lang{ i18n.RU, i18n.EN }) {
+				text, err := tt.gr.ByDate(tg.HTML, lang, at(tt.at, 12, 0), 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := tg.HTML.Escape(i18n.T(lang, tt.want)); !strings.Contains(text, want) {
+					t.Errorf("misses %q:\n%s", want, text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"embed"
+	"errors"
+	"strings"
+	"text/template"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+	"github.com/sergeykochiev/ivgpu-schedule/i18n"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+)
+
+const (
+	TemplateDay = "day"
+	TemplateExams = "exams"
+	TemplateReminder = "reminder"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplatesFS embed.FS
+
+// Placeholders so that templates parse, the real ones are bound to the
+// formatter of each render.
+var templateFuncs = template.FuncMap{
+	"esc": func(s string) string { return s },
+	"bold": func(s string) string { return s },
+	"italic": func(s string) string { return s },
+	"code": func(s string) string { return s },
+	"link": func(text, url string) string { return text },
+	"tr": func(key string, args ...any) string { return key },
+	"join": strings.Join,
+}
+
+var templates = template.Must(
+	template.New("").Funcs(templateFuncs).ParseFS(defaultTemplatesFS, "templates/*.tmpl"),
+)
+
+type LessonView struct {
+	Date string
+	Weekday string
+	Form string
+	Title string
+	Lecturers []string
+	Time string
+	Rooms []string
+	Remote bool
+	RemoteLink string
+	RemoteTitle string
+}
+
+type DayView struct {
+	Date string
+	Weekday string
+	WeekNumber int
+	WeekName string
+	NotStarted bool
+	Finished bool
+	// Upstream has no periods for the group at all
+	Missing bool
+	Short bool
+	Holiday bool
+	WorksAsDate string
+	WorksAsWeekday string
+	Lessons []LessonView
+}
+
+// ExamGroupView is an exam along with its consultations, or a
+// consultation whose exam upstream doesn't list
+type ExamGroupView struct {
+	Past bool
+	Lessons []LessonView
+}
+
+type ExamsView struct {
+	Missing bool
+	Countdown string
+	Groups []ExamGroupView
+	// Entries without dates, listed after everything else
+	Undated []LessonView
+}
+
+type ReminderView struct {
+	Heading string
+	Lesson LessonView
+}
+
+// LoadTemplates overrides the embedded templates with every *.tmpl file in
+// dir. Files only need to redefine the templates they change.
+func LoadTemplates(dir string) error {
+	t, err := templates.Clone()
+	if err != nil {
+		return err
+	}
+	t, err = t.ParseFS(os.DirFS(dir), "*.tmpl")
+	if err != nil {
+		return errors.Join(common.ErrLoadTemplates, err)
+	}
+	templates = t
+	return nil
+}
+
+func render(f tg.Formatter, lang i18n.Lang, name string, view any) (string, error) {
+	t, err := templates.Clone()
+	if err != nil {
+		return "", err
+	}
+	t.Funcs(template.FuncMap{
+		"esc": f.Escape,
+		"bold": f.Bold,
+		"italic": f.Italic,
+		"code": f.Code,
+		"link": f.Link,
+		"tr": func(key string, args ...any) string {
+			return i18n.T(lang, i18n.Key(key), args...)
+		},
+	})
+	var sb strings.Builder
+	if err = t.ExecuteTemplate(&sb, name, view); err != nil {
+		return "", errors.Join(common.ErrRenderTemplate, err)
+	}
+	return sb.String(), nil
+}
+
+func shortDate(t time.Time) string {
+	return fmt.Sprintf("%d.%d", t.Day(), t.Month())
+}
+
+func (l LessonOnPeriod) View(tt Timetable, rd RemoteDesc) (v LessonView) {
+	v = LessonView{
+		Form: l.Form,
+		Title: l.LessonTitle,
+		Rooms: l.Room,
+		Remote: l.Remote,
+		RemoteLink: rd.RemoteLink,
+		RemoteTitle: rd.RemoteAbr,
+	}
+	if r, ok := tt.Range(l.LessonTime); ok {
+		v.Time = r.String()
+	}
+	if v.RemoteTitle == "" {
+		v.RemoteTitle = rd.RemoteLink
+	}
+	for _, lr := range(l.Lecturers) {
+		v.Lecturers = append(v.Lecturers, lr.Name())
+	}
+	return
+}
+
+func (ll LessonsOnPeriod) View(tt Timetable, rd RemoteDesc) (v []LessonView) {
+	for _, l := range(ll) {
+		v = append(v, l.View(tt, rd))
+	}
+	return
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"time"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+)
+
+const (
+	WeekFirst = 1
+	WeekSecond = 2
+)
+
+// daysBetween counts calendar days from a to b, immune to DST and to the
+// time of day of either argument.
+func daysBetween(a time.Time, b time.Time) int {
+	a = a.In(common.Location)
+	b = b.In(common.Location)
+	ua := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	ub := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(ub.Sub(ua).Hours() / 24)
+}
+
+// mondayOf is the start of the ISO week containing t
+func mondayOf(t time.Time) time.Time {
+	day := common.StartOfDay(t)
+	return day.AddDate(0, 0, -common.WeekdayToISO(day.Weekday()))
+}
+
+func floorDiv(a int, b int) int {
+	q := a / b
+	if a % b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+func otherWeek(week int) int {
+	if week == WeekFirst {
+		return WeekSecond
+	}
+	return WeekFirst
+}
+
+func (gs GroupSchedule) Start() time.Time {
+	return totime(gs.StartDate)
+}
+
+func (gs GroupSchedule) End() time.Time {
+	return totime(gs.EndDate)
+}
+
+func (gs GroupSchedule) Contains(t time.Time) bool {
+	return dateBetween(t, gs.Start(), gs.End())
+}
+
+// WeekNumber is the academic week of t within the period, the week that
+// contains StartDate being 1. Dates before the period give zero or less.
+func (gs GroupSchedule) WeekNumber(t time.Time) int {
+	return floorDiv(daysBetween(mondayOf(gs.Start()), mondayOf(t)), 7) + 1
+}
+
+// WeekAt is the parity (WeekFirst or WeekSecond) of the week containing t.
+// WeekStart is the parity of the week containing StartDate and the weeks
+// alternate from there on, across any number of weeks.
+func (gs GroupSchedule) WeekAt(t time.Time) int {
+	week := gs.WeekStart
+	if week != WeekSecond {
+		week = WeekFirst
+	}
+	if (gs.WeekNumber(t) - 1) % 2 != 0 {
+		return otherWeek(week)
+	}
+	return week
+}
+
+type WeekInfo struct {
+	Number int
+	Parity int
+}
+
+// CurrentWeek tells which academic week t falls into, ok is false when no
+// period contains t.
+func (gr GroupResponse) CurrentWeek(t time.Time) (info WeekInfo, ok bool) {
+	schedule, ok := gr.ScheduleAt(t)
+	if !ok {
+		return
+	}
+	info.Number = schedule.WeekNumber(t)
+	info.Parity = schedule.WeekAt(t)
+	return
+}
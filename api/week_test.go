@@ -0,0 +1,134 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+)
+
+func period(start string, end string, weekStart int) GroupSchedule {
+	return GroupSchedule{ EduForm: EduFormOch, StartDate: start, EndDate: end, WeekStart: weekStart }
+}
+
+var semesters = []GroupSchedule{
+	// Starts on Monday
+	period("2025-09-01", "2025-12-31", WeekFirst),
+	period("2025-09-01", "2025-12-31", WeekSecond),
+	// Starts mid-week, the week of StartDate is still the first one
+	period("2025-09-03", "2025-12-31", WeekFirst),
+	period("2025-09-03", "2025-12-31", WeekSecond),
+	// Spring, starting on Sunday right before the first week of lessons
+	period("2026-02-08", "2026-06-30", WeekFirst),
+	// Upstream sent no parity, the first week is assumed
+	period("2024-09-02", "2024-12-29", 0),
+}
+
+func TestWeekNumber(t *testing.T) {
+	tests := []struct {
+		schedule GroupSchedule
+		date string
+		want int
+	}{
+		{ semesters[0], "2025-09-01", 1 },
+		{ semesters[0], "2025-09-07", 1 },
+		{ semesters[0], "2025-09-08", 2 },
+		{ semesters[0], "2025-09-15", 3 },
+		{ semesters[0], "2025-09-21", 3 },
+		{ semesters[0], "2025-10-27", 9 },
+		{ semesters[0], "2025-12-31", 18 },
+		// Before the period
+		{ semesters[0], "2025-08-31", 0 },
+		{ semesters[0], "2025-08-24", -1 },
+		// After it
+		{ semesters[0], "2026-01-05", 19 },
+		{ semesters[2], "2025-09-01", 1 },
+		{ semesters[2], "2025-09-03", 1 },
+		{ semesters[2], "2025-09-07", 1 },
+		{ semesters[2], "2025-09-08", 2 },
+		{ semesters[2], "2025-09-17", 3 },
+		{ semesters[4], "2026-02-08", 1 },
+		{ semesters[4], "2026-02-09", 2 },
+		{ semesters[4], "2026-02-23", 4 },
+		{ semesters[4], "2026-06-30", 22 },
+		{ semesters[5], "2024-12-29", 17 },
+		{ semesters[5], "2025-01-13", 20 },
+	}
+	for _, tt := range(tests) {
+		for _, hour := range([]int{ 0, 23 }) {
+			name := fmt.Sprintf("%s from %s at %d", tt.date, tt.schedule.StartDate, hour)
+			t.Run(name, func(t *testing.T) {
+				if got := tt.schedule.WeekNumber(at(tt.date, hour, 59)); got != tt.want {
+					t.Errorf("WeekNumber = %d, want %d", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestWeekAt(t *testing.T) {
+	tests := []struct {
+		schedule GroupSchedule
+		date string
+		want int
+	}{
+		{ semesters[0], "2025-09-01", WeekFirst },
+		{ semesters[0], "2025-09-08", WeekSecond },
+		{ semesters[0], "2025-09-15", WeekFirst },
+		{ semesters[0], "2025-09-22", WeekSecond },
+		{ semesters[0], "2025-12-29", WeekSecond },
+		{ semesters[0], "2025-08-31", WeekSecond },
+		{ semesters[0], "2025-08-24", WeekFirst },
+		{ semesters[0], "2026-01-05", WeekFirst },
+		{ semesters[1], "2025-09-01", WeekSecond },
+		{ semesters[1], "2025-09-08", WeekFirst },
+		{ semesters[1], "2025-09-15", WeekSecond },
+		{ semesters[1], "2025-08-31", WeekFirst },
+		{ semesters[2], "2025-09-03", WeekFirst },
+		{ semesters[2], "2025-09-07", WeekFirst },
+		{ semesters[2], "2025-09-10", WeekSecond },
+		{ semesters[2], "2025-09-17", WeekFirst },
+		{ semesters[3], "2025-09-03", WeekSecond },
+		{ semesters[3], "2025-09-10", WeekFirst },
+		{ semesters[3], "2025-09-17", WeekSecond },
+		{ semesters[4], "2026-02-08", WeekFirst },
+		{ semesters[4], "2026-02-09", WeekSecond },
+		{ semesters[4], "2026-02-16", WeekFirst },
+		{ semesters[5], "2024-09-02", WeekFirst },
+		{ semesters[5], "2024-09-09", WeekSecond },
+	}
+	for _, tt := range(tests) {
+		name := fmt.Sprintf("%s from %s starting with %d", tt.date, tt.schedule.StartDate, tt.schedule.WeekStart)
+		t.Run(name, func(t *testing.T) {
+			if got := tt.schedule.WeekAt(at(tt.date, 12, 0)); got != tt.want {
+				t.Errorf("WeekAt = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentWeek(t *testing.T) {
+	gr := GroupResponse{ Schedule: []GroupSchedule{ semesters[2], semesters[4] } }
+	tests := []struct {
+		date string
+		want WeekInfo
+		ok bool
+	}{
+		{ "2025-09-02", WeekInfo{}, false },
+		{ "2025-09-03", WeekInfo{ Number: 1, Parity: WeekFirst }, true },
+		{ "2025-09-17", WeekInfo{ Number: 3, Parity: WeekFirst }, true },
+		{ "2025-11-05", WeekInfo{ Number: 10, Parity: WeekSecond }, true },
+		{ "2025-12-31", WeekInfo{ Number: 18, Parity: WeekSecond }, true },
+		// Between the semesters
+		{ "2026-01-15", WeekInfo{}, false },
+		{ "2026-02-08", WeekInfo{ Number: 1, Parity: WeekFirst }, true },
+		{ "2026-03-02", WeekInfo{ Number: 5, Parity: WeekFirst }, true },
+		{ "2026-07-01", WeekInfo{}, false },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.date, func(t *testing.T) {
+			got, ok := gr.CurrentWeek(at(tt.date, 12, 0))
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("CurrentWeek = %+v, %t, want %+v, %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package calendar
+
+import (
+	"os"
+	"io"
+	"embed"
+	"fmt"
+	"sync"
+	"time"
+	"bufio"
+	"errors"
+	"strings"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+)
+
+type Kind string
+
+const (
+	// Pre-holiday day, the short timetable is in effect
+	KindShort Kind = "short"
+	// Public holiday or a day off transferred from another date
+	KindHoliday Kind = "holiday"
+	// Weekend day made a working one, it follows the schedule of the
+	// date it was transferred from
+	KindWorkday Kind = "workday"
+	// A day overriding another kind with the regular week, e.g. a short
+	// day from the file that admins turned off
+	KindRegular Kind = "regular"
+)
+
+const DefaultFile = "ru.txt"
+
+//go:embed ru.txt
+var defaultFS embed.FS
+
+const DateLayout = "2006-01-02"
+
+type Day struct {
+	Date string
+	Kind Kind
+	// Only for KindWorkday, the date whose schedule is followed
+	As string
+}
+
+// Calendar holds the days that differ from a regular week. It is filled
+// from a file of "YYYY-MM-DD kind [YYYY-MM-DD]" lines and from admin
+// commands.
+type Calendar struct {
+	mu sync.RWMutex
+	days map[string]Day
+}
+
+// Default is consulted by schedule rendering, it starts with the embedded
+// production calendar
+var Default = mustLoadDefault()
+
+func mustLoadDefault() *Calendar {
+	c := New()
+	f, err := defaultFS.Open(DefaultFile)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	if err = c.Read(f); err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func New() *Calendar {
+	return &Calendar{ days: make(map[string]Day) }
+}
+
+func key(t time.Time) string {
+	return t.In(common.Location).Format(DateLayout)
+}
+
+func ParseDate(s string) (time.Time, error) {
+	t, err := time.ParseInLocation(DateLayout, s, common.Location)
+	if err != nil {
+		return t, errors.Join(common.ErrParseCalendar, err)
+	}
+	return t, nil
+}
+
+func parseKind(s string) (Kind, error) {
+	switch (Kind(s)) {
+	case KindShort, KindHoliday, KindWorkday, KindRegular:
+		return Kind(s), nil
+	}
+	return "", errors.Join(common.ErrParseCalendar, fmt.Errorf("unknown day kind %q", s))
+}
+
+func ParseLine(line string) (d Day, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		err = errors.Join(common.ErrParseCalendar, fmt.Errorf("%q: want \"YYYY-MM-DD kind\"", line))
+		return
+	}
+	if _, err = ParseDate(fields[0]); err != nil {
+		return
+	}
+	d.Date = fields[0]
+	if d.Kind, err = parseKind(fields[1]); err != nil {
+		return
+	}
+	switch {
+	case d.Kind == KindWorkday && len(fields) == 3:
+		if _, err = ParseDate(fields[2]); err != nil {
+			return
+		}
+		d.As = fields[2]
+	case d.Kind == KindWorkday:
+		err = errors.Join(common.ErrParseCalendar, fmt.Errorf("%q: want \"YYYY-MM-DD workday YYYY-MM-DD\"", line))
+	case len(fields) != 2:
+		err = errors.Join(common.ErrParseCalendar, fmt.Errorf("%q: want \"YYYY-MM-DD %s\"", line, d.Kind))
+	}
+	return
+}
+
+// Read adds the days listed in r, blank lines and # comments are skipped
+func (c *Calendar) Read(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+		d, err := ParseLine(line)
+		if err != nil {
+			return errors.Join(fmt.Errorf("line %d", n), err)
+		}
+		c.Set(d)
+	}
+	return sc.Err()
+}
+
+// Load replaces the calendar with the contents of the file at path
+func (c *Calendar) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Join(common.ErrLoadCalendar, err)
+	}
+	defer f.Close()
+	loaded := New()
+	if err = loaded.Read(f); err != nil {
+		return errors.Join(common.ErrLoadCalendar, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.days = loaded.days
+	return nil
+}
+
+func (c *Calendar) Set(d Day) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.days[d.Date] = d
+}
+
+func (c *Calendar) Get(t time.Time) (Day, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	d, ok := c.days[key(t)]
+	return d, ok
+}
+
+func (c *Calendar) IsHoliday(t time.Time) bool {
+	d, ok := c.Get(t)
+	return ok && d.Kind == KindHoliday
+}
+
+// WorksAs returns the date whose schedule a transferred working day follows
+func (c *Calendar) WorksAs(t time.Time) (time.Time, bool) {
+	d, ok := c.Get(t)
+	if !ok || d.Kind != KindWorkday {
+		return time.Time{}, false
+	}
+	as, err := ParseDate(d.As)
+	return as, err == nil
+}
+
+func (c *Calendar) IsShort(t time.Time) bool {
+	d, ok := c.Get(t)
+	return ok && d.Kind == KindShort
+}
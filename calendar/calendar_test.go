@@ -0,0 +1,53 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegularOverridesShort(t *testing.T) {
+	c := New()
+	err := c.Read(strings.NewReader("2026-06-11 short\n2026-11-01 workday 2026-11-03\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	short, _ := ParseDate("2026-06-11")
+	if !c.IsShort(short) {
+		t.Fatal("short day from the file isn't short")
+	}
+	// What admins stored is applied after the file
+	c.Set(Day{ Date: "2026-06-11", Kind: KindRegular })
+	if c.IsShort(short) || c.IsHoliday(short) {
+		t.Error("regular day still short")
+	}
+	if _, ok := c.WorksAs(short); ok {
+		t.Error("regular day transferred")
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want Day
+		ok bool
+	}{
+		{ "2026-06-11 short", Day{ Date: "2026-06-11", Kind: KindShort }, true },
+		{ "2026-06-11 regular", Day{ Date: "2026-06-11", Kind: KindRegular }, true },
+		{ "2026-11-01 workday 2026-11-03", Day{ Date: "2026-11-01", Kind: KindWorkday, As: "2026-11-03" }, true },
+		{ "2026-11-01 workday", Day{}, false },
+		{ "2026-06-11 regular 2026-06-12", Day{}, false },
+		{ "2026-06-11 long", Day{}, false },
+		{ "11.06.2026 short", Day{}, false },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.line, func(t *testing.T) {
+			d, err := ParseLine(tt.line)
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok %t", err, tt.ok)
+			}
+			if tt.ok && d != tt.want {
+				t.Errorf("ParseLine = %+v, want %+v", d, tt.want)
+			}
+		})
+	}
+}
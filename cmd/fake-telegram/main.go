@@ -0,0 +1,104 @@
+package main
+
+import (
+	"log"
+	"flag"
+	"time"
+	"strconv"
+	"net/http"
+	"encoding/json"
+	"github.com/sergeykochiev/ivgpu-schedule/tg/tgfake"
+)
+
+// Scripting endpoints, served next to the Bot API:
+//   POST /fake/message  {"chat_id": 1, "text": "/start"}
+//   POST /fake/callback {"chat_id": 1, "message_id": 2, "data": "..."} or {"chat_id": 1, "message_id": 2, "button": "ИИТ"}
+//   GET  /fake/reply?chat_id=1&timeout=5s
+//   GET  /fake/replies?chat_id=1
+
+type scriptRequest struct {
+	ChatId int `json:"chat_id"`
+	MessageId int `json:"message_id"`
+	Text string `json:"text"`
+	Data string `json:"data"`
+	Button string `json:"button"`
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeErr(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, map[string]string{ "error": err.Error() })
+}
+
+func chatIdParam(r *http.Request) (int, error) {
+	return strconv.Atoi(r.URL.Query().Get("chat_id"))
+}
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8081", "listen address")
+	token := flag.String("token", "test", "bot token accepted by the server")
+	flag.Parse()
+
+	srv := tgfake.New(*token)
+	mux := http.NewServeMux()
+	mux.Handle("/bot" + *token + "/", srv)
+	mux.HandleFunc("POST /fake/message", func(w http.ResponseWriter, r *http.Request) {
+		var req scriptRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErr(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJson(w, http.StatusOK, map[string]int{ "message_id": srv.SendText(req.ChatId, req.Text) })
+	})
+	mux.HandleFunc("POST /fake/callback", func(w http.ResponseWriter, r *http.Request) {
+		var req scriptRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErr(w, http.StatusBadRequest, err)
+			return
+		}
+		var id string
+		var err error
+		if req.Button != "" {
+			id, err = srv.PressButtonByText(req.ChatId, req.MessageId, req.Button)
+		} else {
+			id, err = srv.PressButton(req.ChatId, req.MessageId, req.Data)
+		}
+		if err != nil {
+			writeErr(w, http.StatusNotFound, err)
+			return
+		}
+		writeJson(w, http.StatusOK, map[string]string{ "callback_query_id": id })
+	})
+	mux.HandleFunc("GET /fake/reply", func(w http.ResponseWriter, r *http.Request) {
+		chatId, err := chatIdParam(r)
+		if err != nil {
+			writeErr(w, http.StatusBadRequest, err)
+			return
+		}
+		timeout, err := time.ParseDuration(r.URL.Query().Get("timeout"))
+		if err != nil {
+			timeout = 5 * time.Second
+		}
+		reply, err := srv.NextReply(chatId, timeout)
+		if err != nil {
+			writeErr(w, http.StatusRequestTimeout, err)
+			return
+		}
+		writeJson(w, http.StatusOK, reply)
+	})
+	mux.HandleFunc("GET /fake/replies", func(w http.ResponseWriter, r *http.Request) {
+		chatId, err := chatIdParam(r)
+		if err != nil {
+			writeErr(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJson(w, http.StatusOK, srv.Replies(chatId))
+	})
+
+	log.Printf("Fake Telegram Bot API on http://%s, set TG_API_BASE=%s", *addr, tgfake.ApiBase("http://" + *addr))
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
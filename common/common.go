@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"time"
 	"fmt"
 	"net/http"
@@ -16,74 +17,164 @@ type CallbackData struct {
 	Data string `json:"d"`
 }
 
+// Sentinel is a kind of error handlers join with the cause, it carries
+// its own name so that metrics can label errors with it
+type Sentinel struct {
+	Name string
+	msg string
+}
+
+func sentinel(name string, msg string) *Sentinel {
+	return &Sentinel{ Name: name, msg: msg }
+}
+
+func (s *Sentinel) Error() string {
+	return s.msg
+}
+
 var (
-	ErrNoUser = errors.New("User not found: ")
-	ErrNoGroupId = errors.New("User's group not found: ")
-	ErrDbNotInit = errors.New("DB hasn't initialized yet: ")
-	ErrNotOk = errors.New("Request status is not OK: ")
-	ErrConnectDb = errors.New("Failed to connect to DB: ")
-	ErrGetGroupList = errors.New("Failed to get group list: ")
-	ErrCreateUser = errors.New("Failed to create new user: ")
-	ErrGetUserById = errors.New("Failed to get user by ID: ")
-	ErrSetGroup = errors.New("Failed to set user group: ")
-	ErrEditMsg = errors.New("Failed to edit original message: ")
-	ErrSetUserInst = errors.New("Failed to set user institute: ")
-	ErrInitGroupChoice = errors.New("Failed to init group choice: ")
-	ErrAcceptInstChoice = errors.New("Failed to accept institute choice: ")
-	ErrAcceptGroupChoice = errors.New("Failed to accept group choice: ")
-	ErrAcceptWeekChoice = errors.New("Failed to accept week choice: ")
-	ErrInitWeekChoice = errors.New("Failed to init week choice: ")
-	ErrInitInstChoice = errors.New("Failed to init institute choice: ")
-	ErrGetSchedule = errors.New("Failed to get schedule: ")
-	ErrWeekFromData = errors.New("Failed to parse week from query data: ")
-	ErrSetWeek = errors.New("Failed to update user week: ")
-	ErrCommand = errors.New("Failed to handle command: ")
-	ErrGetExams = errors.New("Failed to get exams: ")
-	ErrGetToday = errors.New("Failed to get today's schedule: ")
-	ErrGetTomorrow = errors.New("Failed to get tomorrow's schedule: ")
-	ErrGetMon = errors.New("Failed to get Monday's schedule: ")
-	ErrGetTue = errors.New("Failed to get Tuesday's schedule: ")
-	ErrGetWed = errors.New("Failed to get Wednesday's schedule: ")
-	ErrGetThu = errors.New("Failed to get Thursday's schedule: ")
-	ErrGetFri = errors.New("Failed to get Friday's schedule: ")
-	ErrGetSat = errors.New("Failed to get Saturday's schedule: ")
-	ErrGetUpdates = errors.New("Failed to get updates: ")
-	ErrInit = errors.New("Failed to init main app: ")
-	ErrHandleMessage = errors.New("Failed to handle message: ")
-	ErrHandleQuery = errors.New("Failed to handle : ")
+	ErrNoUser = sentinel("ErrNoUser", "User not found: ")
+	ErrNoGroupId = sentinel("ErrNoGroupId", "User's group not found: ")
+	ErrDbNotInit = sentinel("ErrDbNotInit", "DB hasn't initialized yet: ")
+	ErrNotOk = sentinel("ErrNotOk", "Request status is not OK: ")
+	ErrConnectDb = sentinel("ErrConnectDb", "Failed to connect to DB: ")
+	ErrGetGroupList = sentinel("ErrGetGroupList", "Failed to get group list: ")
+	ErrCreateUser = sentinel("ErrCreateUser", "Failed to create new user: ")
+	ErrGetUserById = sentinel("ErrGetUserById", "Failed to get user by ID: ")
+	ErrSetGroup = sentinel("ErrSetGroup", "Failed to set user group: ")
+	ErrEditMsg = sentinel("ErrEditMsg", "Failed to edit original message: ")
+	ErrSetUserInst = sentinel("ErrSetUserInst", "Failed to set user institute: ")
+	ErrInitGroupChoice = sentinel("ErrInitGroupChoice", "Failed to init group choice: ")
+	ErrAcceptInstChoice = sentinel("ErrAcceptInstChoice", "Failed to accept institute choice: ")
+	ErrAcceptGroupChoice = sentinel("ErrAcceptGroupChoice", "Failed to accept group choice: ")
+	ErrAcceptWeekChoice = sentinel("ErrAcceptWeekChoice", "Failed to accept week choice: ")
+	ErrInitWeekChoice = sentinel("ErrInitWeekChoice", "Failed to init week choice: ")
+	ErrInitInstChoice = sentinel("ErrInitInstChoice", "Failed to init institute choice: ")
+	ErrGetSchedule = sentinel("ErrGetSchedule", "Failed to get schedule: ")
+	ErrWeekFromData = sentinel("ErrWeekFromData", "Failed to parse week from query data: ")
+	ErrSetWeek = sentinel("ErrSetWeek", "Failed to update user week: ")
+	ErrCommand = sentinel("ErrCommand", "Failed to handle command: ")
+	ErrGetExams = sentinel("ErrGetExams", "Failed to get exams: ")
+	ErrGetWeek = sentinel("ErrGetWeek", "Failed to get current week: ")
+	ErrGetNow = sentinel("ErrGetNow", "Failed to get current lesson: ")
+	ErrParseLessonTime = sentinel("ErrParseLessonTime", "Failed to parse lesson time: ")
+	ErrInvalidTimetable = sentinel("ErrInvalidTimetable", "Invalid timetable: ")
+	ErrInvalidSchedule = sentinel("ErrInvalidSchedule", "Invalid schedule: ")
+	ErrGetToday = sentinel("ErrGetToday", "Failed to get today's schedule: ")
+	ErrGetTomorrow = sentinel("ErrGetTomorrow", "Failed to get tomorrow's schedule: ")
+	ErrGetMon = sentinel("ErrGetMon", "Failed to get Monday's schedule: ")
+	ErrGetTue = sentinel("ErrGetTue", "Failed to get Tuesday's schedule: ")
+	ErrGetWed = sentinel("ErrGetWed", "Failed to get Wednesday's schedule: ")
+	ErrGetThu = sentinel("ErrGetThu", "Failed to get Thursday's schedule: ")
+	ErrGetFri = sentinel("ErrGetFri", "Failed to get Friday's schedule: ")
+	ErrGetSat = sentinel("ErrGetSat", "Failed to get Saturday's schedule: ")
+	ErrGetUpdates = sentinel("ErrGetUpdates", "Failed to get updates: ")
+	ErrInit = sentinel("ErrInit", "Failed to init main app: ")
+	ErrHandleMessage = sentinel("ErrHandleMessage", "Failed to handle message: ")
+	ErrHandleQuery = sentinel("ErrHandleQuery", "Failed to handle : ")
+	ErrTgBlocked = sentinel("ErrTgBlocked", "Bot was blocked by the user: ")
+	ErrTgChatNotFound = sentinel("ErrTgChatNotFound", "Chat not found: ")
+	ErrTgNotModified = sentinel("ErrTgNotModified", "Message is not modified: ")
+	ErrTgMessageNotFound = sentinel("ErrTgMessageNotFound", "Message not found: ")
+	ErrTgTooManyRequests = sentinel("ErrTgTooManyRequests", "Too many requests: ")
+	ErrSetActive = sentinel("ErrSetActive", "Failed to update user activity: ")
+	ErrAnswerQuery = sentinel("ErrAnswerQuery", "Failed to answer callback query: ")
+	ErrAcceptLangChoice = sentinel("ErrAcceptLangChoice", "Failed to accept language choice: ")
+	ErrInitLangChoice = sentinel("ErrInitLangChoice", "Failed to init language choice: ")
+	ErrSetLang = sentinel("ErrSetLang", "Failed to update user language: ")
+	ErrParseCalendar = sentinel("ErrParseCalendar", "Failed to parse calendar: ")
+	ErrLoadCalendar = sentinel("ErrLoadCalendar", "Failed to load calendar: ")
+	ErrSetCalendarDay = sentinel("ErrSetCalendarDay", "Failed to update calendar day: ")
+	ErrNotAdmin = sentinel("ErrNotAdmin", "Command is for admins only: ")
+	ErrLoadLocation = sentinel("ErrLoadLocation", "Failed to load timezone: ")
+	ErrLoadTemplates = sentinel("ErrLoadTemplates", "Failed to load templates: ")
+	ErrRenderTemplate = sentinel("ErrRenderTemplate", "Failed to render template: ")
+	ErrInitReminders = sentinel("ErrInitReminders", "Failed to init reminders choice: ")
+	ErrSetReminders = sentinel("ErrSetReminders", "Failed to update user reminders: ")
+	ErrSendReminders = sentinel("ErrSendReminders", "Failed to send reminders: ")
+	ErrPanic = sentinel("ErrPanic", "Recovered from panic: ")
+	ErrInvalidUpdate = sentinel("ErrInvalidUpdate", "Invalid update: ")
+	ErrUnsupportedUpdate = sentinel("ErrUnsupportedUpdate", "Unsupported update: ")
+	ErrRateLimited = sentinel("ErrRateLimited", "Too many updates from the chat: ")
+	ErrUpdateOffset = sentinel("ErrUpdateOffset", "Failed to persist update offset: ")
 )
 
+// SentinelNames lists the sentinels err was joined with, outermost first
+func SentinelNames(err error) (names []string) {
+	if err == nil {
+		return
+	}
+	if s, ok := err.(*Sentinel); ok {
+		names = append(names, s.Name)
+	}
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		names = append(names, SentinelNames(e.Unwrap())...)
+	case interface{ Unwrap() []error }:
+		for _, err := range(e.Unwrap()) {
+			names = append(names, SentinelNames(err)...)
+		}
+	}
+	return
+}
+
 const (
 	CallbackQueryTypeInstitute = "insttt"
 	CallbackQueryTypeChangeInstitute = "cngint"
 	CallbackQueryTypeWeek = "cngwek"
 	CallbackQueryTypeGroups = "groups"
+	CallbackQueryTypeLang = "cnglng"
+	CallbackQueryTypeReminders = "rmnder"
 )
 
-const (
-	ReplyKeyboardButtonToday = "На сегодня"
-	ReplyKeyboardButtonTomorrow = "На завтра"
-	ReplyKeyboardButtonMonday = "Пн"
-	ReplyKeyboardButtonTuesday = "Вт"
-	ReplyKeyboardButtonWednesday = "Ср"
-	ReplyKeyboardButtonThursday = "Чт"
-	ReplyKeyboardButtonFriday = "Пт"
-	ReplyKeyboardButtonSaturday = "Сб"
-	ReplyKeyboardButtonChangeGroup = "Сменить группу"
-	ReplyKeyboardButtonChangeWeek = "Сменить неделю"
-	ReplyKeyboardButtonExams = "Все экзамены"
-)
+const DefaultTimezone = "Europe/Moscow"
+
+// Location is the timezone of the university, every date in the schedule
+// and every "today" is in it regardless of the server TZ.
+var Location = mustLoadLocation(DefaultTimezone)
+
+// Clock is injectable so that date-dependent behaviour can be checked at
+// an arbitrary moment, e.g. right before midnight.
+type Clock interface {
+	Now() time.Time
+}
+
+type SystemClock struct{}
+
+type FixedClock struct {
+	T time.Time
+}
+
+func (SystemClock) Now() time.Time {
+	return time.Now().In(Location)
+}
 
-var WeekdayNames = [7]string{
-	"Понедельник",
-	"Вторник",
-	"Среда",
-	"Четверг",
-	"Пятница",
-	"Суббота",
-	"Воскресение",
+func (c FixedClock) Now() time.Time {
+	return c.T.In(Location)
+}
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+func SetLocation(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return errors.Join(ErrLoadLocation, err)
+	}
+	Location = loc
+	return nil
+}
+
+// StartOfDay is midnight of t's date in Location
+func StartOfDay(t time.Time) time.Time {
+	t = t.In(Location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, Location)
 }
-var Weeknames = [3]string{"Текущая", "Первая", "Вторая"}
 
 func (cd CallbackData) ToJson() string {
 	out, _ := json.Marshal(cd)
@@ -102,8 +193,20 @@ func ParseCallbackData(data string) (query CallbackData) {
 	return
 }
 
-func Req(method string, url string, body []byte) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+// StatusError is a response Req got with a status other than 200
+type StatusError struct {
+	Method string
+	Url string
+	Code int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %s %s", e.Method, e.Url, e.Status)
+}
+
+func Req(ctx context.Context, method string, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
@@ -116,23 +219,13 @@ func Req(method string, url string, body []byte) (*http.Response, error) {
 	if res.StatusCode != 200 {
 		return res, errors.Join(
 			ErrNotOk,
-			fmt.Errorf("%s: %s %s", method, url, res.Status),
+			&StatusError{ Method: method, Url: url, Code: res.StatusCode, Status: res.Status },
 			errors.New(string(body)),
 		)
 	}
 	return res, nil
 }
 
-func JsonReq[ResT any, ReqT any](url string, body ReqT) (jsonRes ResT, err error) {
-	bytes, err := json.Marshal(body)
-	if err != nil {
-		return
-	}
-	res, err := Req(http.MethodPost, url, bytes)
-	json.NewDecoder(res.Body).Decode(&jsonRes)
-	return
-}
-
 func Concat(s string, i int) string {
 	return fmt.Sprintf("%s%d", s, i)
 }
@@ -140,7 +233,3 @@ func Concat(s string, i int) string {
 func StartsWith(s string, frg string) bool {
 	return len(s) >= len(frg) && s[:len(frg)] == frg
 }
-
-func StatefulButton(name string, state string) string {
-	return fmt.Sprintf("%s (сейчас - %s)", name, state)
-}
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"fmt"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"go/ast"
+	"go/token"
+	"go/parser"
+)
+
+// A sentinel named after another variable would be counted under the
+// wrong label
+func TestSentinelNamesMatchVariables(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "common.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked := 0
+	for _, decl := range(file.Decls) {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range(gen.Specs) {
+			vs := spec.(*ast.ValueSpec)
+			for i, ident := range(vs.Names) {
+				call, ok := vs.Values[i].(*ast.CallExpr)
+				if !ok || fmt.Sprint(call.Fun) != "sentinel" {
+					continue
+				}
+				checked++
+				name, err := strconv.Unquote(call.Args[0].(*ast.BasicLit).Value)
+				if err != nil || name != ident.Name {
+					t.Errorf("%s is named %s", ident.Name, call.Args[0].(*ast.BasicLit).Value)
+				}
+			}
+		}
+	}
+	if checked == 0 {
+		t.Error("no sentinels found in common.go")
+	}
+}
+
+func TestSentinelNames(t *testing.T) {
+	tests := []struct {
+		name string
+		err error
+		want []string
+	}{
+		{ "nil", nil, nil },
+		{ "plain error", errors.New("boom"), nil },
+		{ "sentinel", ErrNoUser, []string{ "ErrNoUser" } },
+		{ "joined", errors.Join(ErrGetToday, ErrGetSchedule, errors.New("timeout")), []string{ "ErrGetToday", "ErrGetSchedule" } },
+		{ "nested", errors.Join(ErrCommand, errors.Join(ErrGetWeek, ErrNoGroupId)), []string{ "ErrCommand", "ErrGetWeek", "ErrNoGroupId" } },
+		{ "wrapped", fmt.Errorf("handler: %w", errors.Join(ErrSetLang, ErrConnectDb)), []string{ "ErrSetLang", "ErrConnectDb" } },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SentinelNames(tt.err); !slices.Equal(got, tt.want) {
+				t.Errorf("SentinelNames = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if !errors.Is(errors.Join(ErrGetToday, errors.New("timeout")), ErrGetToday) {
+		t.Error("errors.Is doesn't find a joined sentinel")
+	}
+}
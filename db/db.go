@@ -1,8 +1,11 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	_ "github.com/lib/pq"
+	"database/sql/driver"
+	_ "embed"
+	"github.com/lib/pq"
 	"errors"
 	"fmt"
 	"github.com/sergeykochiev/ivgpu-schedule/common"
@@ -12,12 +15,56 @@ type AppDb struct {
 	Conn *sql.DB
 }
 
+// Store is everything the app keeps between updates, AppDb keeps it in
+// Postgres
+type Store interface {
+	Ping(ctx context.Context) error
+	Close() error
+	CreateUser(ctx context.Context, id int, lang string) error
+	GetUserById(ctx context.Context, id int) (User, error)
+	SetUserInstitute(ctx context.Context, id int, abr string) error
+	SetUserGroup(ctx context.Context, id int, group int, name string) error
+	SetUserWeek(ctx context.Context, id int, week int) error
+	SetUserActive(ctx context.Context, id int, active bool) error
+	SetUserLang(ctx context.Context, id int, lang string) error
+	SetUserReminders(ctx context.Context, id int, evening bool, morning bool) error
+	GetReminderUsers(ctx context.Context) ([]User, error)
+	MarkReminderSent(ctx context.Context, userId int, event string, slot string, day string) (bool, error)
+	UnmarkReminderSent(ctx context.Context, userId int, event string, slot string) error
+	PruneSentReminders(ctx context.Context, before string) error
+	CountActiveUsers(ctx context.Context) (int, error)
+	GetCalendarDays(ctx context.Context) ([]CalendarDay, error)
+	SetCalendarDay(ctx context.Context, d CalendarDay) error
+	GetUpdateOffset(ctx context.Context) (int, error)
+	SetUpdateOffset(ctx context.Context, offset int) error
+	IsUpdateProcessed(ctx context.Context, id int) (bool, error)
+	MarkUpdateProcessed(ctx context.Context, id int) error
+}
+
+type CalendarDay struct {
+	Day string
+	Kind string
+	WorksAs string
+}
+
 type User struct {
 	Id int
 	InstituteAbr string
 	GroupId int
 	GroupName string
 	Week int
+	Active bool
+	Lang string
+	RemindEvening bool
+	RemindMorning bool
+}
+
+func (db *AppDb) Close() error {
+	return db.Conn.Close()
+}
+
+func (db *AppDb) Ping(ctx context.Context) error {
+	return db.Conn.PingContext(ctx)
 }
 
 func PostgresConnStr(user, password, host, port, name, params string) string {
@@ -27,44 +74,213 @@ func PostgresConnStr(user, password, host, port, name, params string) string {
 	)
 }
 
-func (u* User) scan(row *sql.Row) error {
-	return row.Scan(&u.Id, &u.InstituteAbr, &u.GroupId, &u.GroupName)
+const userColumns = "Id, InstituteAbr, GroupId, GroupName, Week, Active, Lang, RemindEvening, RemindMorning"
+
+type scanner interface {
+	Scan(dest ...any) error
 }
 
-func InitAppDb(name, connStr string) (db AppDb, err error) {
-	db.Conn, err = sql.Open(name, connStr)
-	if _, err = db.Conn.Query("select * from TgUsers limit 1"); err != nil {
-		err = errors.Join(common.ErrDbNotInit, err)
+func (u* User) scan(row scanner) error {
+	return row.Scan(&u.Id, &u.InstituteAbr, &u.GroupId, &u.GroupName, &u.Week, &u.Active, &u.Lang, &u.RemindEvening, &u.RemindMorning)
+}
+
+// Transient is true for errors the DB may not return on the next try: a
+// lost connection, an overloaded or restarting server, a transaction
+// conflict
+func Transient(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch (pqErr.Code.Class()) {
+		// connection_exception, transaction_rollback,
+		// insufficient_resources, operator_intervention
+		case "08", "40", "53", "57":
+			return true
+		}
+		return false
+	}
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone)
+}
+
+//go:embed schema.sql
+var schema string
+
+func InitAppDb(ctx context.Context, name, connStr string) (db AppDb, err error) {
+	if db.Conn, err = sql.Open(name, connStr); err != nil {
 		return
 	}
-  return
+	if err = db.Migrate(ctx); err != nil {
+		err = errors.Join(common.ErrDbNotInit, err)
+	}
+	return
 }
 
-func (db* AppDb) CreateUser(id int) (err error) {
-	_, err = db.Conn.Exec("insert into TgUsers (Id) values ($1)", id)
+// Migrate brings the schema up to date, databases created by any earlier
+// version included
+func (db *AppDb) Migrate(ctx context.Context) error {
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.ExecContext(ctx, schema); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateUser leaves an existing user as is
+func (db* AppDb) CreateUser(ctx context.Context, id int, lang string) (err error) {
+	_, err = db.Conn.ExecContext(ctx, "insert into TgUsers (Id, Lang) values ($1, $2) on conflict (Id) do nothing", id, lang)
 	return
 }
 
-func (db* AppDb) GetUserById(id int) (user User, err error) {
-	row := db.Conn.QueryRow("select Id, InstituteAbr, GroupId, GroupName from TgUsers where id = $1", id)
+func (db* AppDb) GetUserById(ctx context.Context, id int) (user User, err error) {
+	row := db.Conn.QueryRowContext(ctx, "select " + userColumns + " from TgUsers where id = $1", id)
 	err = user.scan(row)
-	if err != nil {
+	// Anything else, a cancelled context included, isn't the user's fault
+	if errors.Is(err, sql.ErrNoRows) {
 		err = errors.Join(common.ErrNoUser, err)
 	}
 	return
 }
 
-func (db* AppDb) SetUserInstitute(id int, abr string) (err error) {
-	_, err = db.Conn.Exec("update TgUsers set InstituteAbr = $1 where id = $2", abr, id)
+func (db* AppDb) SetUserInstitute(ctx context.Context, id int, abr string) (err error) {
+	_, err = db.Conn.ExecContext(ctx, "update TgUsers set InstituteAbr = $1 where id = $2", abr, id)
+	return
+}
+
+func (db* AppDb) SetUserGroup(ctx context.Context, id int, group int, name string) (err error) {
+	_, err = db.Conn.ExecContext(ctx, "update TgUsers set GroupId = $1, GroupName = $2 where id = $3", group, name, id)
+	return
+}
+
+func (db *AppDb) SetUserWeek(ctx context.Context, id int, week int) (err error) {
+	_, err = db.Conn.ExecContext(ctx, "update TgUsers set Week = $1 where id = $2", week, id)
+	return
+}
+
+func (db *AppDb) SetUserActive(ctx context.Context, id int, active bool) (err error) {
+	_, err = db.Conn.ExecContext(ctx, "update TgUsers set Active = $1 where id = $2", active, id)
+	return
+}
+
+func (db *AppDb) SetUserLang(ctx context.Context, id int, lang string) (err error) {
+	_, err = db.Conn.ExecContext(ctx, "update TgUsers set Lang = $1 where id = $2", lang, id)
+	return
+}
+
+func (db *AppDb) SetUserReminders(ctx context.Context, id int, evening bool, morning bool) (err error) {
+	_, err = db.Conn.ExecContext(ctx, "update TgUsers set RemindEvening = $1, RemindMorning = $2 where id = $3", evening, morning, id)
+	return
+}
+
+// GetReminderUsers lists active users with a group and any reminder on
+func (db *AppDb) GetReminderUsers(ctx context.Context) (users []User, err error) {
+	rows, err := db.Conn.QueryContext(ctx, "select " + userColumns + " from TgUsers where Active and GroupId != 0 and (RemindEvening or RemindMorning)")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u User
+		if err = u.scan(rows); err != nil {
+			return
+		}
+		users = append(users, u)
+	}
+	err = rows.Err()
+	return
+}
+
+// MarkReminderSent records the reminder of the event held on day, sent is
+// false when it already was recorded and must not go out again.
+func (db *AppDb) MarkReminderSent(ctx context.Context, userId int, event string, slot string, day string) (sent bool, err error) {
+	res, err := db.Conn.ExecContext(ctx, 
+		"insert into SentReminders (UserId, Event, Slot, Day) values ($1, $2, $3, $4) on conflict do nothing",
+		userId, event, slot, day,
+	)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	sent = n == 1
+	return
+}
+
+func (db *AppDb) UnmarkReminderSent(ctx context.Context, userId int, event string, slot string) (err error) {
+	_, err = db.Conn.ExecContext(ctx, "delete from SentReminders where UserId = $1 and Event = $2 and Slot = $3", userId, event, slot)
+	return
+}
+
+// PruneSentReminders forgets reminders of events held before the day,
+// they are never due again
+func (db *AppDb) PruneSentReminders(ctx context.Context, before string) (err error) {
+	_, err = db.Conn.ExecContext(ctx, "delete from SentReminders where Day < $1", before)
+	return
+}
+
+func (db *AppDb) CountActiveUsers(ctx context.Context) (n int, err error) {
+	err = db.Conn.QueryRowContext(ctx, "select count(*) from TgUsers where Active").Scan(&n)
+	return
+}
+
+func (db *AppDb) GetCalendarDays(ctx context.Context) (days []CalendarDay, err error) {
+	rows, err := db.Conn.QueryContext(ctx, "select Day, Kind, WorksAs from CalendarDays")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d CalendarDay
+		if err = rows.Scan(&d.Day, &d.Kind, &d.WorksAs); err != nil {
+			return
+		}
+		days = append(days, d)
+	}
+	err = rows.Err()
+	return
+}
+
+func (db *AppDb) SetCalendarDay(ctx context.Context, d CalendarDay) (err error) {
+	_, err = db.Conn.ExecContext(ctx, 
+		"insert into CalendarDays (Day, Kind, WorksAs) values ($1, $2, $3) on conflict (Day) do update set Kind = excluded.Kind, WorksAs = excluded.WorksAs",
+		d.Day, d.Kind, d.WorksAs,
+	)
+	return
+}
+
+const stateUpdateOffset = "update_offset"
+
+// GetUpdateOffset is the first update not handled yet, 0 before the first
+// one ever is
+func (db *AppDb) GetUpdateOffset(ctx context.Context) (offset int, err error) {
+	err = db.Conn.QueryRowContext(ctx, "select Value from BotState where Key = $1", stateUpdateOffset).Scan(&offset)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	return
+}
+
+// SetUpdateOffset also forgets processed updates before offset, Telegram
+// never delivers those again.
+func (db *AppDb) SetUpdateOffset(ctx context.Context, offset int) (err error) {
+	_, err = db.Conn.ExecContext(ctx,
+		"insert into BotState (Key, Value) values ($1, $2) on conflict (Key) do update set Value = excluded.Value",
+		stateUpdateOffset, offset,
+	)
+	if err != nil {
+		return
+	}
+	_, err = db.Conn.ExecContext(ctx, "delete from ProcessedUpdates where UpdateId < $1", offset)
 	return
 }
 
-func (db* AppDb) SetUserGroup(id int, group int, name string) (err error) {
-	_, err = db.Conn.Exec("update TgUsers set GroupId = $1, GroupName = $2 where id = $3", group, name, id)
+func (db *AppDb) IsUpdateProcessed(ctx context.Context, id int) (processed bool, err error) {
+	err = db.Conn.QueryRowContext(ctx, "select exists (select 1 from ProcessedUpdates where UpdateId = $1)", id).Scan(&processed)
 	return
 }
 
-func (db *AppDb) SetUserWeek(id int, week int) (err error) {
-	_, err = db.Conn.Exec("update TgUsers set Week = $1 where id = $2", week, id)
+func (db *AppDb) MarkUpdateProcessed(ctx context.Context, id int) (err error) {
+	_, err = db.Conn.ExecContext(ctx, "insert into ProcessedUpdates (UpdateId) values ($1) on conflict do nothing", id)
 	return
 }
@@ -0,0 +1,208 @@
+package dbfake
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"sync"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+	"github.com/sergeykochiev/ivgpu-schedule/db"
+)
+
+type reminder struct {
+	userId int
+	event string
+	slot string
+}
+
+// Store keeps everything in memory, for running the app without Postgres.
+// Updates of users who don't exist are ignored, the way SQL updates are.
+type Store struct {
+	mu sync.Mutex
+	users map[int]*db.User
+	days map[string]db.CalendarDay
+	// The day of the event of every sent reminder
+	reminders map[reminder]string
+	offset int
+	processed map[int]bool
+}
+
+var _ db.Store = (*Store)(nil)
+
+func New() *Store {
+	return &Store{
+		users: make(map[int]*db.User),
+		days: make(map[string]db.CalendarDay),
+		reminders: make(map[reminder]string),
+		processed: make(map[int]bool),
+	}
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (s *Store) Close() error {
+	return nil
+}
+
+// update calls fn on the user under the lock, if there is one
+func (s *Store) update(id int, fn func(u *db.User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[id]; ok {
+		fn(u)
+	}
+	return nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, id int, lang string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[id]; ok {
+		return nil
+	}
+	s.users[id] = &db.User{ Id: id, Lang: lang, Active: true, RemindEvening: true, RemindMorning: true }
+	return nil
+}
+
+func (s *Store) GetUserById(ctx context.Context, id int) (db.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return db.User{}, errors.Join(common.ErrNoUser, sql.ErrNoRows)
+	}
+	return *u, nil
+}
+
+func (s *Store) SetUserInstitute(ctx context.Context, id int, abr string) error {
+	return s.update(id, func(u *db.User) { u.InstituteAbr = abr })
+}
+
+func (s *Store) SetUserGroup(ctx context.Context, id int, group int, name string) error {
+	return s.update(id, func(u *db.User) { u.GroupId, u.GroupName = group, name })
+}
+
+func (s *Store) SetUserWeek(ctx context.Context, id int, week int) error {
+	return s.update(id, func(u *db.User) { u.Week = week })
+}
+
+func (s *Store) SetUserActive(ctx context.Context, id int, active bool) error {
+	return s.update(id, func(u *db.User) { u.Active = active })
+}
+
+func (s *Store) SetUserLang(ctx context.Context, id int, lang string) error {
+	return s.update(id, func(u *db.User) { u.Lang = lang })
+}
+
+func (s *Store) SetUserReminders(ctx context.Context, id int, evening bool, morning bool) error {
+	return s.update(id, func(u *db.User) { u.RemindEvening, u.RemindMorning = evening, morning })
+}
+
+func (s *Store) GetReminderUsers(ctx context.Context) (users []db.User, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range(s.users) {
+		if u.Active && u.GroupId != 0 && (u.RemindEvening || u.RemindMorning) {
+			users = append(users, *u)
+		}
+	}
+	slices.SortFunc(users, func(a, b db.User) int { return a.Id - b.Id })
+	return
+}
+
+func (s *Store) MarkReminderSent(ctx context.Context, userId int, event string, slot string, day string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := reminder{ userId, event, slot }
+	if _, ok := s.reminders[r]; ok {
+		return false, nil
+	}
+	s.reminders[r] = day
+	return true, nil
+}
+
+func (s *Store) UnmarkReminderSent(ctx context.Context, userId int, event string, slot string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reminders, reminder{ userId, event, slot })
+	return nil
+}
+
+func (s *Store) PruneSentReminders(ctx context.Context, before string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for r, day := range(s.reminders) {
+		if day < before {
+			delete(s.reminders, r)
+		}
+	}
+	return nil
+}
+
+// SentReminders counts the reminders recorded as sent
+func (s *Store) SentReminders() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.reminders)
+}
+
+func (s *Store) CountActiveUsers(ctx context.Context) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range(s.users) {
+		if u.Active {
+			n++
+		}
+	}
+	return
+}
+
+func (s *Store) GetCalendarDays(ctx context.Context) (days []db.CalendarDay, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range(s.days) {
+		days = append(days, d)
+	}
+	return
+}
+
+func (s *Store) SetCalendarDay(ctx context.Context, d db.CalendarDay) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.days[d.Day] = d
+	return nil
+}
+
+func (s *Store) GetUpdateOffset(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offset, nil
+}
+
+func (s *Store) SetUpdateOffset(ctx context.Context, offset int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset = offset
+	for id := range(s.processed) {
+		if id < offset {
+			delete(s.processed, id)
+		}
+	}
+	return nil
+}
+
+func (s *Store) IsUpdateProcessed(ctx context.Context, id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.processed[id], nil
+}
+
+func (s *Store) MarkUpdateProcessed(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processed[id] = true
+	return nil
+}
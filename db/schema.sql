@@ -0,0 +1,43 @@
+-- Applied on every start, each statement must be safe to run again on a
+-- database created by any earlier version. Columns and tables added after
+-- the first release are added separately, CREATE TABLE alone would skip
+-- them on existing databases.
+
+CREATE TABLE IF NOT EXISTS TgUsers (
+	Id SERIAL PRIMARY KEY,
+	InstituteAbr VARCHAR(50) DEFAULT '',
+	GroupId INT DEFAULT 0,
+	GroupName VARCHAR(50) DEFAULT '',
+	Week INT DEFAULT 0
+);
+
+ALTER TABLE TgUsers ADD COLUMN IF NOT EXISTS Active BOOLEAN DEFAULT TRUE;
+ALTER TABLE TgUsers ADD COLUMN IF NOT EXISTS Lang VARCHAR(8) DEFAULT '';
+ALTER TABLE TgUsers ADD COLUMN IF NOT EXISTS RemindEvening BOOLEAN DEFAULT TRUE;
+ALTER TABLE TgUsers ADD COLUMN IF NOT EXISTS RemindMorning BOOLEAN DEFAULT TRUE;
+
+CREATE TABLE IF NOT EXISTS CalendarDays (
+	Day VARCHAR(10) PRIMARY KEY,
+	Kind VARCHAR(16) NOT NULL,
+	WorksAs VARCHAR(10) DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS BotState (
+	Key VARCHAR(32) PRIMARY KEY,
+	Value BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS ProcessedUpdates (
+	UpdateId BIGINT PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS SentReminders (
+	UserId INT NOT NULL,
+	Event VARCHAR(64) NOT NULL,
+	Slot VARCHAR(16) NOT NULL,
+	PRIMARY KEY (UserId, Event, Slot)
+);
+
+-- The date of the event, rows of past events are pruned. Rows recorded
+-- before the column was added have it empty and go with the first prune.
+ALTER TABLE SentReminders ADD COLUMN IF NOT EXISTS Day VARCHAR(10) DEFAULT '';
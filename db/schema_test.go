@@ -0,0 +1,58 @@
+package db
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var commentRe = regexp.MustCompile(`--[^\n]*`)
+
+func statements() (stmts []string) {
+	for _, stmt := range(strings.Split(commentRe.ReplaceAllString(schema, ""), ";")) {
+		if stmt = strings.Join(strings.Fields(stmt), " "); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return
+}
+
+// The schema runs on every start, against databases of any age
+func TestSchemaIsIdempotent(t *testing.T) {
+	for _, stmt := range(statements()) {
+		upper := strings.ToUpper(stmt)
+		switch {
+		case strings.HasPrefix(upper, "CREATE TABLE IF NOT EXISTS "):
+		case strings.HasPrefix(upper, "ALTER TABLE ") && strings.Contains(upper, " ADD COLUMN IF NOT EXISTS "):
+		default:
+			t.Errorf("statement can't run twice: %s", stmt)
+		}
+	}
+}
+
+// A column only in CREATE TABLE never reaches existing databases
+func TestSchemaAddsUserColumns(t *testing.T) {
+	created := ""
+	for _, stmt := range(statements()) {
+		if strings.HasPrefix(stmt, "CREATE TABLE IF NOT EXISTS TgUsers ") {
+			created = stmt
+		}
+	}
+	if created == "" {
+		t.Fatal("TgUsers isn't created")
+	}
+	original := []string{ "Id", "InstituteAbr", "GroupId", "GroupName", "Week" }
+	for _, column := range(strings.Split(userColumns, ", ")) {
+		isOriginal := false
+		for _, o := range(original) {
+			isOriginal = isOriginal || o == column
+		}
+		added := strings.Contains(schema, "ALTER TABLE TgUsers ADD COLUMN IF NOT EXISTS " + column + " ")
+		switch {
+		case isOriginal && !strings.Contains(created, " " + column + " "):
+			t.Errorf("%s isn't created", column)
+		case !isOriginal && !added:
+			t.Errorf("%s isn't added to existing databases", column)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package health
+
+import (
+	"time"
+	"context"
+	"net/http"
+	"encoding/json"
+)
+
+type Status string
+
+const (
+	StatusOk Status = "ok"
+	// A failed check that isn't critical, the whole report stays ok
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+type Check struct {
+	Name string
+	// Only critical checks fail the report, others turn into warnings
+	Critical bool
+	// detail is shown whatever the outcome, e.g. how old something is
+	Run func(ctx context.Context) (detail string, err error)
+}
+
+type Result struct {
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status Status `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+func (c Check) result(detail string, err error) Result {
+	r := Result{ Status: StatusOk, Detail: detail }
+	if err != nil {
+		r.Status, r.Error = StatusWarn, err.Error()
+		if c.Critical {
+			r.Status = StatusFail
+		}
+	}
+	return r
+}
+
+func (report *Report) add(c Check, r Result) {
+	report.Checks[c.Name] = r
+	if r.Status == StatusFail {
+		report.Status = StatusFail
+	}
+}
+
+// Run runs every check at once, each one given until ctx is done. Checks
+// still running by then fail with ctx's error, whether they mind ctx or
+// not.
+func Run(ctx context.Context, checks []Check) Report {
+	report := Report{ Status: StatusOk, Checks: make(map[string]Result, len(checks)) }
+	type finished struct {
+		i int
+		r Result
+	}
+	// Buffered for checks outliving ctx not to leak
+	results := make(chan finished, len(checks))
+	for i, c := range(checks) {
+		go func() {
+			detail, err := c.Run(ctx)
+			results <- finished{ i, c.result(detail, err) }
+		}()
+	}
+	done := make([]bool, len(checks))
+	// Once ctx is done the rest of the rounds don't block
+	for range(checks) {
+		select {
+		case f := <-results:
+			done[f.i] = true
+			report.add(checks[f.i], f.r)
+		case <-ctx.Done():
+		}
+	}
+	for i, c := range(checks) {
+		if !done[i] {
+			report.add(c, c.result("", ctx.Err()))
+		}
+	}
+	return report
+}
+
+// Handler serves the report as JSON, with 503 when it fails so that
+// orchestrators need nothing but the status code
+func Handler(timeout time.Duration, checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+		report := Run(ctx, checks)
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status == StatusFail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,126 @@
+package health
+
+import (
+	"time"
+	"errors"
+	"context"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"encoding/json"
+)
+
+func ok(ctx context.Context) (string, error) {
+	return "fine", nil
+}
+
+func failing(ctx context.Context) (string, error) {
+	return "", errors.New("down")
+}
+
+// hanging ignores ctx, the way a check stuck on a lock would
+func hanging(release chan struct{}) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		<-release
+		return "late", nil
+	}
+}
+
+func TestHandler(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	tests := []struct {
+		name string
+		checks []Check
+		code int
+		status Status
+		results map[string]Status
+	}{
+		{
+			"all ok",
+			[]Check{ { Name: "db", Critical: true, Run: ok }, { Name: "cache", Run: ok } },
+			http.StatusOK, StatusOk,
+			map[string]Status{ "db": StatusOk, "cache": StatusOk },
+		},
+		{
+			"critical failing",
+			[]Check{ { Name: "db", Critical: true, Run: failing }, { Name: "cache", Run: ok } },
+			http.StatusServiceUnavailable, StatusFail,
+			map[string]Status{ "db": StatusFail, "cache": StatusOk },
+		},
+		{
+			"non-critical failing",
+			[]Check{ { Name: "db", Critical: true, Run: ok }, { Name: "upstream", Run: failing } },
+			http.StatusOK, StatusOk,
+			map[string]Status{ "db": StatusOk, "upstream": StatusWarn },
+		},
+		{
+			"critical timing out",
+			[]Check{ { Name: "db", Critical: true, Run: hanging(release) }, { Name: "cache", Run: ok } },
+			http.StatusServiceUnavailable, StatusFail,
+			map[string]Status{ "db": StatusFail, "cache": StatusOk },
+		},
+		{
+			"non-critical timing out",
+			[]Check{ { Name: "db", Critical: true, Run: ok }, { Name: "upstream", Run: hanging(release) } },
+			http.StatusOK, StatusOk,
+			map[string]Status{ "db": StatusOk, "upstream": StatusWarn },
+		},
+		{ "no checks", nil, http.StatusOK, StatusOk, map[string]Status{} },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			w := httptest.NewRecorder()
+			Handler(50 * time.Millisecond, tt.checks...).ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("took %s", elapsed)
+			}
+			if w.Code != tt.code {
+				t.Errorf("code %d, want %d", w.Code, tt.code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type %q", ct)
+			}
+			var report Report
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != tt.status {
+				t.Errorf("status %q, want %q", report.Status, tt.status)
+			}
+			if len(report.Checks) != len(tt.results) {
+				t.Errorf("checks %v, want %v", report.Checks, tt.results)
+			}
+			for name, want := range(tt.results) {
+				r := report.Checks[name]
+				if r.Status != want {
+					t.Errorf("%s: status %q, want %q", name, r.Status, want)
+				}
+				// Failures are listed with their reason
+				if want != StatusOk && r.Error == "" {
+					t.Errorf("%s failed without an error", name)
+				}
+			}
+		})
+	}
+}
+
+func TestRunTimeoutError(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+	defer cancel()
+	report := Run(ctx, []Check{ { Name: "db", Critical: true, Run: hanging(release) } })
+	if r := report.Checks["db"]; r.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("error %q, want %q", r.Error, context.DeadlineExceeded)
+	}
+	// A check minding ctx gives its own error
+	report = Run(ctx, []Check{ { Name: "db", Critical: true, Run: func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "waited", errors.New("ping: " + ctx.Err().Error())
+	} } })
+	if r := report.Checks["db"]; r.Status != StatusFail || r.Error == "" {
+		t.Errorf("got %+v, want a failure", r)
+	}
+}
@@ -0,0 +1,74 @@
+package i18n
+
+var en = Catalog{
+	ButtonToday: "Today",
+	ButtonTomorrow: "Tomorrow",
+	ButtonNow: "Now",
+	ButtonMonday: "Mon",
+	ButtonTuesday: "Tue",
+	ButtonWednesday: "Wed",
+	ButtonThursday: "Thu",
+	ButtonFriday: "Fri",
+	ButtonSaturday: "Sat",
+	ButtonChangeGroup: "Change group",
+	ButtonChangeWeek: "Change week",
+	ButtonChangeLang: "Language",
+	ButtonExams: "All exams",
+	ButtonBack: "Back",
+	ButtonStateful: "%s (now - %s)",
+
+	ErrorNoUser: "Use the /start command",
+	ErrorNoGroup: "Choose your group first",
+	ErrorUnknown: "An unknown error occurred",
+	ErrorUnsupported: "I only understand text and buttons",
+	ErrorRateLimited: "Too many requests, please wait a bit",
+
+	ChooseInstitute: "Please choose your institute",
+	ChooseGroup: "Please choose your group",
+	ChooseWeek: "Please choose the week",
+	ChooseLang: "Please choose the language",
+
+	GroupChanged: "Group changed successfully",
+	WeekChanged: "Week changed successfully",
+	LangChanged: "Language changed successfully",
+	ToastGroupChanged: "Group changed",
+	ToastWeekChanged: "Week changed",
+	ToastLangChanged: "Language changed",
+
+	ScheduleDay: "Schedule for %s, %s",
+	ScheduleExams: "Exams and consultations",
+	ScheduleEmpty: "No classes",
+	ScheduleWeek: "Academic week %d (%s)",
+	ScheduleShort: "Shortened day",
+	ScheduleHoliday: "Day off — public holiday",
+	ScheduleWorksAs: "Working day, following the schedule of %s, %s",
+	ScheduleNotStarted: "The semester hasn't started yet",
+	ScheduleFinished: "The semester has ended",
+	ScheduleMissing: "No schedule has been published for the group",
+	ScheduleExamsMissing: "The exam schedule hasn't been published yet",
+	ExamsCountdown: "%[2]s until the %[1]s exam",
+	ExamsToday: "The %s exam is today",
+	ExamsTomorrow: "The %s exam is tomorrow",
+	ExamsPast: "Past",
+	ReminderExamEvening: "Exam tomorrow",
+	ReminderExamMorning: "Exam today",
+	ReminderConsultationEvening: "Consultation tomorrow",
+	ReminderConsultationMorning: "Consultation today",
+	Reminders: "Exam and consultation reminders",
+	ButtonRemindEvening: "The evening before",
+	ButtonRemindMorning: "In the morning of the day",
+	Days: "%d day|%d days",
+	ErrorNotAdmin: "This command is for admins only",
+	CommandUsage: "Usage: %s",
+	ShortDaySet: "%s is marked as a shortened day",
+	ShortDayUnset: "%s is a regular day again",
+	ShortDayHoliday: "%s is a day off in the calendar, /shortday doesn't change it",
+	ShortDayWorkday: "%s is a transferred working day, /shortday doesn't change it",
+	WeekNow: "It is academic week %d, %s",
+	WeekNone: "There is no study period right now",
+	NowCurrent: "Class in progress, %d min left",
+	NowNext: "Next class in %d min",
+	NowNone: "No more classes today",
+
+	LangName: "English",
+}
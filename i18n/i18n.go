@@ -0,0 +1,225 @@
+package i18n
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Lang string
+
+const (
+	RU Lang = "ru"
+	EN Lang = "en"
+)
+
+const Default = RU
+
+type Key string
+
+const (
+	ButtonToday Key = "button.today"
+	ButtonTomorrow Key = "button.tomorrow"
+	ButtonNow Key = "button.now"
+	ButtonMonday Key = "button.monday"
+	ButtonTuesday Key = "button.tuesday"
+	ButtonWednesday Key = "button.wednesday"
+	ButtonThursday Key = "button.thursday"
+	ButtonFriday Key = "button.friday"
+	ButtonSaturday Key = "button.saturday"
+	ButtonChangeGroup Key = "button.change_group"
+	ButtonChangeWeek Key = "button.change_week"
+	ButtonChangeLang Key = "button.change_lang"
+	ButtonExams Key = "button.exams"
+	ButtonBack Key = "button.back"
+	ButtonStateful Key = "button.stateful"
+
+	ErrorNoUser Key = "error.no_user"
+	ErrorNoGroup Key = "error.no_group"
+	ErrorUnknown Key = "error.unknown"
+	ErrorUnsupported Key = "error.unsupported"
+	ErrorRateLimited Key = "error.rate_limited"
+
+	ChooseInstitute Key = "choose.institute"
+	ChooseGroup Key = "choose.group"
+	ChooseWeek Key = "choose.week"
+	ChooseLang Key = "choose.lang"
+
+	GroupChanged Key = "group.changed"
+	WeekChanged Key = "week.changed"
+	LangChanged Key = "lang.changed"
+	ToastGroupChanged Key = "toast.group_changed"
+	ToastWeekChanged Key = "toast.week_changed"
+	ToastLangChanged Key = "toast.lang_changed"
+
+	ScheduleDay Key = "schedule.day"
+	ScheduleExams Key = "schedule.exams"
+	ScheduleEmpty Key = "schedule.empty"
+	ScheduleWeek Key = "schedule.week"
+	ScheduleShort Key = "schedule.short"
+	ScheduleHoliday Key = "schedule.holiday"
+	ScheduleWorksAs Key = "schedule.works_as"
+	ScheduleNotStarted Key = "schedule.not_started"
+	ScheduleFinished Key = "schedule.finished"
+	ScheduleMissing Key = "schedule.missing"
+	ScheduleExamsMissing Key = "schedule.exams_missing"
+	ExamsCountdown Key = "exams.countdown"
+	ExamsToday Key = "exams.today"
+	ExamsTomorrow Key = "exams.tomorrow"
+	ExamsPast Key = "exams.past"
+	ReminderExamEvening Key = "reminder.exam_evening"
+	ReminderExamMorning Key = "reminder.exam_morning"
+	ReminderConsultationEvening Key = "reminder.consultation_evening"
+	ReminderConsultationMorning Key = "reminder.consultation_morning"
+	Reminders Key = "reminders"
+	ButtonRemindEvening Key = "button.remind_evening"
+	ButtonRemindMorning Key = "button.remind_morning"
+	Days Key = "days"
+	ErrorNotAdmin Key = "error.not_admin"
+	CommandUsage Key = "command.usage"
+	ShortDaySet Key = "shortday.set"
+	ShortDayUnset Key = "shortday.unset"
+	ShortDayHoliday Key = "shortday.holiday"
+	ShortDayWorkday Key = "shortday.workday"
+	WeekNow Key = "week.now"
+	WeekNone Key = "week.none"
+	NowCurrent Key = "now.current"
+	NowNext Key = "now.next"
+	NowNone Key = "now.none"
+
+	LangName Key = "lang.name"
+)
+
+type Catalog map[Key]string
+
+var catalogs = map[Lang]Catalog{
+	RU: ru,
+	EN: en,
+}
+
+var weekdays = map[Lang][7]string{
+	RU: { "Понедельник", "Вторник", "Среда", "Четверг", "Пятница", "Суббота", "Воскресенье" },
+	EN: { "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday" },
+}
+
+var weeknames = map[Lang][3]string{
+	RU: { "Текущая", "Первая", "Вторая" },
+	EN: { "Current", "First", "Second" },
+}
+
+// Langs lists supported languages in the order they are offered to users.
+var Langs = []Lang{ RU, EN }
+
+// Parse returns the supported language named by s, or Default.
+func Parse(s string) Lang {
+	if _, ok := catalogs[Lang(s)]; ok {
+		return Lang(s)
+	}
+	return Default
+}
+
+// Detect maps a Telegram language_code (IETF tag, e.g. "en-US") to a
+// supported language. Russian stays the default for the languages of the
+// region, everyone else gets English.
+func Detect(languageCode string) Lang {
+	if languageCode == "" {
+		return Default
+	}
+	base := strings.ToLower(strings.SplitN(languageCode, "-", 2)[0])
+	switch (base) {
+	case "ru", "uk", "be", "kk", "ky", "uz", "tg", "hy", "az":
+		return RU
+	}
+	if _, ok := catalogs[Lang(base)]; ok {
+		return Lang(base)
+	}
+	return EN
+}
+
+func T(lang Lang, key Key, args ...any) string {
+	msg, ok := catalogs[lang][key]
+	if !ok {
+		msg, ok = catalogs[Default][key]
+	}
+	if !ok {
+		return string(key)
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Weekday takes an ISO weekday index, 0 being Monday. Indexes out of
+// range, which only come from broken upstream data, give "".
+func Weekday(lang Lang, weekday int) string {
+	names, ok := weekdays[lang]
+	if !ok {
+		names = weekdays[Default]
+	}
+	if weekday < 0 || weekday >= len(names) {
+		return ""
+	}
+	return names[weekday]
+}
+
+func Weekname(lang Lang, week int) string {
+	names, ok := weeknames[lang]
+	if !ok {
+		names = weeknames[Default]
+	}
+	if week < 0 || week >= len(names) {
+		return ""
+	}
+	return names[week]
+}
+
+// Plural picks the form of a "one|few|many" key for n, English only has
+// the first two.
+func Plural(lang Lang, key Key, n int) string {
+	forms := strings.Split(T(lang, key), "|")
+	form := forms[0]
+	switch {
+	case lang == RU && len(forms) == 3:
+		mod10, mod100 := n % 10, n % 100
+		switch {
+		case mod10 == 1 && mod100 != 11:
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			form = forms[1]
+		default:
+			form = forms[2]
+		}
+	case n != 1 && len(forms) > 1:
+		form = forms[1]
+	}
+	return fmt.Sprintf(form, n)
+}
+
+func Stateful(lang Lang, key Key, state string) string {
+	return T(lang, ButtonStateful, T(lang, key), state)
+}
+
+// Match finds which of keys has text as its label in any language, so
+// that a keyboard sent before the user switched language still works.
+func Match(text string, keys ...Key) (Key, bool) {
+	for _, c := range(catalogs) {
+		for _, key := range(keys) {
+			if c[key] == text {
+				return key, true
+			}
+		}
+	}
+	return "", false
+}
+
+// MatchStateful is Match for buttons created with Stateful, whose label
+// only starts with the translation.
+func MatchStateful(text string, keys ...Key) (Key, bool) {
+	for _, c := range(catalogs) {
+		for _, key := range(keys) {
+			if label, ok := c[key]; ok && strings.HasPrefix(text, label) {
+				return key, true
+			}
+		}
+	}
+	return "", false
+}
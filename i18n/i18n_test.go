@@ -0,0 +1,128 @@
+package i18n
+
+import (
+	"testing"
+)
+
+func TestPlural(t *testing.T) {
+	tests := []struct {
+		n int
+		ru string
+		en string
+	}{
+		{ 0, "0 дней", "0 days" },
+		{ 1, "1 день", "1 day" },
+		{ 2, "2 дня", "2 days" },
+		{ 4, "4 дня", "4 days" },
+		{ 5, "5 дней", "5 days" },
+		{ 11, "11 дней", "11 days" },
+		{ 12, "12 дней", "12 days" },
+		{ 14, "14 дней", "14 days" },
+		{ 21, "21 день", "21 days" },
+		{ 22, "22 дня", "22 days" },
+		{ 25, "25 дней", "25 days" },
+		{ 101, "101 день", "101 days" },
+		{ 111, "111 дней", "111 days" },
+		{ 112, "112 дней", "112 days" },
+		{ 122, "122 дня", "122 days" },
+	}
+	for _, tt := range(tests) {
+		if got := Plural(RU, Days, tt.n); got != tt.ru {
+			t.Errorf("Plural(RU, %d) = %q, want %q", tt.n, got, tt.ru)
+		}
+		if got := Plural(EN, Days, tt.n); got != tt.en {
+			t.Errorf("Plural(EN, %d) = %q, want %q", tt.n, got, tt.en)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		code string
+		want Lang
+	}{
+		{ "", Default },
+		{ "ru", RU },
+		{ "ru-RU", RU },
+		{ "RU", RU },
+		// The languages of the region read Russian rather than English
+		{ "uk", RU },
+		{ "be-BY", RU },
+		{ "kk", RU },
+		{ "en", EN },
+		{ "en-US", EN },
+		{ "en-GB", EN },
+		{ "de", EN },
+		{ "zh-hans", EN },
+	}
+	for _, tt := range(tests) {
+		if got := Detect(tt.code); got != tt.want {
+			t.Errorf("Detect(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, lang := range(Langs) {
+		if got := Parse(string(lang)); got != lang {
+			t.Errorf("Parse(%q) = %q", lang, got)
+		}
+	}
+	for _, s := range([]string{ "", "de", "ru-RU" }) {
+		if got := Parse(s); got != Default {
+			t.Errorf("Parse(%q) = %q, want %q", s, got, Default)
+		}
+	}
+}
+
+// Every message has every translation, T falls back to Russian silently
+func TestCatalogsComplete(t *testing.T) {
+	for _, lang := range(Langs) {
+		for key := range(catalogs[Default]) {
+			if _, ok := catalogs[lang][key]; !ok {
+				t.Errorf("%s misses %s", lang, key)
+			}
+		}
+		for key := range(catalogs[lang]) {
+			if _, ok := catalogs[Default][key]; !ok {
+				t.Errorf("%s has %s, %s doesn't", lang, key, Default)
+			}
+		}
+	}
+}
+
+var buttons = []Key{
+	ButtonToday, ButtonTomorrow, ButtonNow,
+	ButtonMonday, ButtonTuesday, ButtonWednesday, ButtonThursday, ButtonFriday, ButtonSaturday,
+	ButtonExams, ButtonBack,
+}
+
+var statefulButtons = []Key{ ButtonChangeGroup, ButtonChangeWeek, ButtonChangeLang }
+
+// A keyboard in either language keeps working after the user switches
+func TestMatchRoundTrip(t *testing.T) {
+	for _, lang := range(Langs) {
+		for _, key := range(buttons) {
+			if got, ok := Match(T(lang, key), buttons...); !ok || got != key {
+				t.Errorf("Match(%q) = %q, %t, want %q", T(lang, key), got, ok, key)
+			}
+		}
+		for _, key := range(statefulButtons) {
+			text := Stateful(lang, key, "1ИТ1")
+			if got, ok := MatchStateful(text, statefulButtons...); !ok || got != key {
+				t.Errorf("MatchStateful(%q) = %q, %t, want %q", text, got, ok, key)
+			}
+			if got, ok := Match(text, buttons...); ok {
+				t.Errorf("Match(%q) = %q, want no match", text, got)
+			}
+		}
+	}
+	for _, text := range([]string{ "", "today", "Сегодня", "Сменить" }) {
+		if got, ok := Match(text, buttons...); ok {
+			t.Errorf("Match(%q) = %q, want no match", text, got)
+		}
+		if got, ok := MatchStateful(text, statefulButtons...); ok {
+			t.Errorf("MatchStateful(%q) = %q, want no match", text, got)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package i18n
+
+var ru = Catalog{
+	ButtonToday: "На сегодня",
+	ButtonTomorrow: "На завтра",
+	ButtonNow: "Сейчас",
+	ButtonMonday: "Пн",
+	ButtonTuesday: "Вт",
+	ButtonWednesday: "Ср",
+	ButtonThursday: "Чт",
+	ButtonFriday: "Пт",
+	ButtonSaturday: "Сб",
+	ButtonChangeGroup: "Сменить группу",
+	ButtonChangeWeek: "Сменить неделю",
+	ButtonChangeLang: "Язык",
+	ButtonExams: "Все экзамены",
+	ButtonBack: "Назад",
+	ButtonStateful: "%s (сейчас - %s)",
+
+	ErrorNoUser: "Используйте команду /start",
+	ErrorNoGroup: "Сначала выберите группу",
+	ErrorUnknown: "Произошла неизвестная ошибка",
+	ErrorUnsupported: "Я понимаю только текст и кнопки",
+	ErrorRateLimited: "Слишком много запросов, подождите немного",
+
+	ChooseInstitute: "Пожалуйста, выберите свое направление (институт)",
+	ChooseGroup: "Пожалуйста, выберите свою группу",
+	ChooseWeek: "Пожалуйста, выберите неделю",
+	ChooseLang: "Пожалуйста, выберите язык",
+
+	GroupChanged: "Группа изменена успешно",
+	WeekChanged: "Неделя сменена успешно",
+	LangChanged: "Язык изменен успешно",
+	ToastGroupChanged: "Группа изменена",
+	ToastWeekChanged: "Неделя изменена",
+	ToastLangChanged: "Язык изменен",
+
+	ScheduleDay: "Расписание на %s, %s",
+	ScheduleExams: "Расписание экзаменов и консультаций",
+	ScheduleEmpty: "Пар нет",
+	ScheduleWeek: "Учебная неделя %d (%s)",
+	ScheduleShort: "Сокращенный день",
+	ScheduleHoliday: "Выходной — праздник",
+	ScheduleWorksAs: "Рабочий день по расписанию: %s, %s",
+	ScheduleNotStarted: "Семестр ещё не начался",
+	ScheduleFinished: "Семестр закончился",
+	ScheduleMissing: "Расписание группы не опубликовано",
+	ScheduleExamsMissing: "Расписание экзаменов ещё не опубликовано",
+	ExamsCountdown: "До экзамена по %s — %s",
+	ExamsToday: "Сегодня экзамен по %s",
+	ExamsTomorrow: "Завтра экзамен по %s",
+	ExamsPast: "Прошло",
+	ReminderExamEvening: "Завтра экзамен",
+	ReminderExamMorning: "Сегодня экзамен",
+	ReminderConsultationEvening: "Завтра консультация",
+	ReminderConsultationMorning: "Сегодня консультация",
+	Reminders: "Напоминания об экзаменах и консультациях",
+	ButtonRemindEvening: "Накануне вечером",
+	ButtonRemindMorning: "Утром в тот же день",
+	Days: "%d день|%d дня|%d дней",
+	ErrorNotAdmin: "Команда доступна только администраторам",
+	CommandUsage: "Использование: %s",
+	ShortDaySet: "%s отмечен как сокращенный день",
+	ShortDayUnset: "%s снова обычный день",
+	ShortDayHoliday: "%s — выходной по календарю, /shortday его не меняет",
+	ShortDayWorkday: "%s — перенесенный рабочий день, /shortday его не меняет",
+	WeekNow: "Сейчас идет %d-я учебная неделя, %s",
+	WeekNone: "Сейчас нет учебного периода",
+	NowCurrent: "Идет пара, до конца %d мин.",
+	NowNext: "Следующая пара через %d мин.",
+	NowNone: "Сегодня пар больше нет",
+
+	LangName: "Русский",
+}
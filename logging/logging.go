@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"time"
+	"errors"
+	"context"
+	"strings"
+	"strconv"
+	"log/slog"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+type Config struct {
+	Level slog.Level
+	Format string
+	// Empty means stdout, which is what Docker collects
+	File string
+	Rotate RotateConfig
+}
+
+// ConfigFromEnv reads LOG_LEVEL (debug, info, warn, error), LOG_FORMAT
+// (json, text), LOG_FILE and the rotation settings LOG_MAX_SIZE_MB,
+// LOG_MAX_AGE (a duration, e.g. 24h) and LOG_MAX_BACKUPS.
+func ConfigFromEnv() (cfg Config, err error) {
+	cfg = Config{
+		Level: slog.LevelInfo,
+		Format: FormatJSON,
+		File: os.Getenv("LOG_FILE"),
+		Rotate: DefaultRotate,
+	}
+	var errs []error
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		errs = append(errs, cfg.Level.UnmarshalText([]byte(level)))
+	}
+	if format := strings.ToLower(os.Getenv("LOG_FORMAT")); format != "" {
+		cfg.Format = format
+		if format != FormatJSON && format != FormatText {
+			errs = append(errs, fmt.Errorf("unknown LOG_FORMAT %q", format))
+		}
+	}
+	if size := os.Getenv("LOG_MAX_SIZE_MB"); size != "" {
+		mb, err := strconv.ParseInt(size, 10, 64)
+		errs = append(errs, err)
+		cfg.Rotate.MaxSize = mb << 20
+	}
+	if age := os.Getenv("LOG_MAX_AGE"); age != "" {
+		cfg.Rotate.MaxAge, err = time.ParseDuration(age)
+		errs = append(errs, err)
+	}
+	if backups := os.Getenv("LOG_MAX_BACKUPS"); backups != "" {
+		cfg.Rotate.MaxBackups, err = strconv.Atoi(backups)
+		errs = append(errs, err)
+	}
+	err = errors.Join(errs...)
+	return
+}
+
+// New builds the logger described by cfg. The closer is the log file,
+// if any.
+func New(cfg Config) (*slog.Logger, io.Closer, error) {
+	var w io.Writer = os.Stdout
+	var closer io.Closer = io.NopCloser(nil)
+	if cfg.File != "" {
+		f, err := OpenRotating(cfg.File, cfg.Rotate)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, closer = f, f
+	}
+	opts := &slog.HandlerOptions{ Level: cfg.Level }
+	var h slog.Handler = slog.NewJSONHandler(w, opts)
+	if cfg.Format == FormatText {
+		h = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(h), closer, nil
+}
+
+type ctxKey struct{}
+
+// With attaches l to ctx, From gets it back anywhere down the call chain
+func With(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// From is the logger attached to ctx, or slog's default one
+func From(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// Err is the attribute errors are logged under
+func Err(err error) slog.Attr {
+	return slog.Any("err", err)
+}
@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"os"
+	"fmt"
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+	"slices"
+	"path/filepath"
+)
+
+type RotateConfig struct {
+	// Rotate once the file would grow past this many bytes, 0 disables
+	MaxSize int64
+	// Rotate files older than this, 0 disables
+	MaxAge time.Duration
+	// Rotated files kept, older ones are removed, 0 keeps all
+	MaxBackups int
+}
+
+var DefaultRotate = RotateConfig{
+	MaxSize: 10 << 20,
+	MaxAge: 24 * time.Hour,
+	MaxBackups: 7,
+}
+
+const backupLayout = "20060102-150405.000"
+
+// A failed rotation is tried again no sooner than this, logging goes on
+// into the current file meanwhile
+const rotateRetry = time.Minute
+
+// RotatingFile is an append-only log file that moves itself aside to
+// path.<time> when it gets too big or too old.
+type RotatingFile struct {
+	mu sync.Mutex
+	path string
+	cfg RotateConfig
+	f *os.File
+	size int64
+	opened time.Time
+	failed time.Time
+	now func() time.Time
+}
+
+func OpenRotating(path string, cfg RotateConfig) (*RotatingFile, error) {
+	r := &RotatingFile{ path: path, cfg: cfg, now: time.Now }
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE | os.O_WRONLY | os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size, r.opened = f, info.Size(), r.now()
+	// A file carried over from a previous run is as old as its content
+	if r.size > 0 {
+		r.opened = info.ModTime()
+	}
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	tooBig := r.cfg.MaxSize > 0 && r.size > 0 && r.size + int64(len(p)) > r.cfg.MaxSize
+	tooOld := r.cfg.MaxAge > 0 && now.Sub(r.opened) > r.cfg.MaxAge
+	if (tooBig || tooOld) && now.Sub(r.failed) >= rotateRetry {
+		if err := r.rotate(now); err != nil {
+			r.failed = now
+			// Nowhere else to report it, the log is what failed
+			fmt.Fprintf(os.Stderr, "logging: failed to rotate %s, writing on to it: %v\n", r.path, err)
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate moves the file aside while it is still open, on failure r.f is
+// left as it was and stays writable. A file already gone, e.g. removed by
+// hand, is just created anew.
+func (r *RotatingFile) rotate(now time.Time) error {
+	err := os.Rename(r.path, r.path + "." + now.Format(backupLayout))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	old := r.f
+	if err := r.open(); err != nil {
+		return err
+	}
+	old.Close()
+	r.prune()
+	return nil
+}
+
+// prune removes the oldest backups past MaxBackups, the names sort by time
+func (r *RotatingFile) prune() {
+	if r.cfg.MaxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(r.path + ".*")
+	if err != nil || len(backups) <= r.cfg.MaxBackups {
+		return
+	}
+	slices.Sort(backups)
+	for _, b := range(backups[:len(backups) - r.cfg.MaxBackups]) {
+		os.Remove(b)
+	}
+}
+
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
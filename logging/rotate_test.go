@@ -0,0 +1,155 @@
+package logging
+
+import (
+	"os"
+	"time"
+	"strings"
+	"testing"
+	"path/filepath"
+)
+
+// openTest opens dir/bot.log with a clock the test moves by hand
+func openTest(t *testing.T, cfg RotateConfig) (*RotatingFile, *time.Time) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bot.log")
+	r, err := OpenRotating(path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	r.opened = now
+	return r, &now
+}
+
+func write(t *testing.T, r *RotatingFile, s string) {
+	t.Helper()
+	if n, err := r.Write([]byte(s)); err != nil || n != len(s) {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func backups(t *testing.T, r *RotatingFile) []string {
+	t.Helper()
+	b, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRotateBySize(t *testing.T) {
+	r, now := openTest(t, RotateConfig{ MaxSize: 10 })
+	write(t, r, "12345\n")
+	write(t, r, "abc\n")
+	*now = now.Add(time.Second)
+	// Would make it 14 bytes
+	write(t, r, "next\n")
+	b := backups(t, r)
+	if len(b) != 1 {
+		t.Fatalf("backups = %v, want one", b)
+	}
+	if got := read(t, b[0]); got != "12345\nabc\n" {
+		t.Errorf("backup = %q", got)
+	}
+	if got := read(t, r.path); got != "next\n" {
+		t.Errorf("file = %q", got)
+	}
+}
+
+func TestRotateOversizedWrite(t *testing.T) {
+	r, _ := openTest(t, RotateConfig{ MaxSize: 4 })
+	// An empty file takes anything, rather than rotating on every write
+	write(t, r, "longer than the limit\n")
+	if b := backups(t, r); len(b) != 0 {
+		t.Errorf("backups = %v, want none", b)
+	}
+}
+
+func TestRotateByAge(t *testing.T) {
+	r, now := openTest(t, RotateConfig{ MaxAge: time.Hour })
+	write(t, r, "old\n")
+	*now = now.Add(59 * time.Minute)
+	write(t, r, "still\n")
+	if b := backups(t, r); len(b) != 0 {
+		t.Fatalf("rotated before MaxAge: %v", b)
+	}
+	*now = now.Add(2 * time.Minute)
+	write(t, r, "new\n")
+	b := backups(t, r)
+	if len(b) != 1 {
+		t.Fatalf("backups = %v, want one", b)
+	}
+	if want := r.path + "." + now.Format(backupLayout); b[0] != want {
+		t.Errorf("backup = %s, want %s", b[0], want)
+	}
+	if got := read(t, r.path); got != "new\n" {
+		t.Errorf("file = %q", got)
+	}
+}
+
+func TestRotatePrunesBackups(t *testing.T) {
+	r, now := openTest(t, RotateConfig{ MaxSize: 1, MaxBackups: 2 })
+	for _, line := range([]string{ "a", "b", "c", "d", "e" }) {
+		*now = now.Add(time.Second)
+		write(t, r, line)
+	}
+	b := backups(t, r)
+	if len(b) != 2 {
+		t.Fatalf("backups = %v, want two", b)
+	}
+	// The newest are kept
+	if got := read(t, b[0]) + read(t, b[1]) + read(t, r.path); got != "cde" {
+		t.Errorf("kept %q, want cde", got)
+	}
+}
+
+func TestRotateFailureKeepsLogging(t *testing.T) {
+	r, now := openTest(t, RotateConfig{ MaxSize: 4 })
+	write(t, r, "one\n")
+	*now = now.Add(time.Second)
+	// A non-empty directory in the way of the backup, the rename fails
+	// whoever runs the test
+	blocker := r.path + "." + now.Format(backupLayout)
+	if err := os.MkdirAll(filepath.Join(blocker, "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write(t, r, "two\n")
+	*now = now.Add(time.Second)
+	write(t, r, "three\n")
+	if got := read(t, r.path); got != "one\ntwo\nthree\n" {
+		t.Errorf("file = %q, want every line", got)
+	}
+	// Tried again once rotateRetry passes
+	os.RemoveAll(blocker)
+	*now = now.Add(rotateRetry)
+	write(t, r, "four\n")
+	if got := read(t, r.path); got != "four\n" {
+		t.Errorf("file = %q after the retry", got)
+	}
+	b := backups(t, r)
+	if len(b) != 1 || !strings.HasSuffix(read(t, b[0]), "three\n") {
+		t.Errorf("backups = %v", b)
+	}
+}
+
+func TestRotateFileRemoved(t *testing.T) {
+	r, now := openTest(t, RotateConfig{ MaxSize: 4 })
+	write(t, r, "one\n")
+	os.Remove(r.path)
+	*now = now.Add(time.Second)
+	write(t, r, "two\n")
+	if got := read(t, r.path); got != "two\n" {
+		t.Errorf("file = %q", got)
+	}
+}
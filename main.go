@@ -1,75 +1,136 @@
 package main
 
 import (
+	"syscall"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"context"
 	"log"
-	"fmt"
+	"log/slog"
 	"os"
+	"fmt"
 	"errors"
 	"strings"
 	"slices"
 	"time"
 	"strconv"
+	"math"
+	"net/http"
+	_ "time/tzdata"
 	"github.com/joho/godotenv"
 	"github.com/sergeykochiev/ivgpu-schedule/tg"
 	"github.com/sergeykochiev/ivgpu-schedule/api"
 	"github.com/sergeykochiev/ivgpu-schedule/db"
 	"github.com/sergeykochiev/ivgpu-schedule/common"
+	"github.com/sergeykochiev/ivgpu-schedule/i18n"
+	"github.com/sergeykochiev/ivgpu-schedule/calendar"
+	"github.com/sergeykochiev/ivgpu-schedule/router"
+	"github.com/sergeykochiev/ivgpu-schedule/logging"
+	"github.com/sergeykochiev/ivgpu-schedule/metrics"
+	"github.com/sergeykochiev/ivgpu-schedule/health"
 )
 
-const (
-	LogInfo string = " INFO "
-	LogWarn string = " WARN "
-	LogErr string = " ERR "
-)
-
-type IAppLogger interface {
-	Log(string, ...any)
-	Fatal(...any)
-}
-
-type FileLogger struct {
-	logfile *os.File
-}
-
-func NewFileLogger(logfile *os.File) FileLogger {
-	return FileLogger{
-		logfile: logfile,
+// fatal is log.Fatal for slog
+func fatal(logger *slog.Logger, msg string, err error) {
+	if err != nil {
+		logger.Error(msg, logging.Err(err))
+	} else {
+		logger.Error(msg)
 	}
-}
-
-func (l FileLogger) Log(lvlPrefix string, msg ...any) {
-	fmt.Fprint(l.logfile, time.Now())
-	fmt.Fprint(l.logfile, lvlPrefix)
-	fmt.Fprintln(l.logfile, msg...)
-}
-
-func (l FileLogger) Fatal(msg ...any) {
-	l.Log(LogErr, msg...)
 	os.Exit(1)
 }
 
 type MainApp struct {
 	bot tg.Bot
-	db db.AppDb
+	db db.Store
 	whitelist []string
-	logger IAppLogger
+	admins []string
+	logger *slog.Logger
+	metrics *router.Metrics
+	clock common.Clock
 	numWorkers int
-	updChan chan tg.Update
 	grouplist api.GrouplistResponse
-	groupsSchedules map[int]api.GroupResponse
+	offsets *router.Offsets
+	offsetMu sync.Mutex
+	schedulesMu sync.RWMutex
+	groupsSchedules map[int]cachedSchedule
+	// Unix nanoseconds of the latest successful getUpdates
+	lastPoll atomic.Int64
+}
+
+type cachedSchedule struct {
+	api.GroupResponse
+	fetched time.Time
 }
 
 const AppDbName = "schedule.db"
 
-func initMainApp(token string, numWorkers int, whitelist []string, logger IAppLogger) (app MainApp, err error) {
+// Metrics and health checks are served here
+const DefaultHttpAddr = ":8080"
+
+// A scrape or a probe must not hang on a stuck DB or upstream
+const (
+	MetricsDbTimeout = 5 * time.Second
+	HealthTimeout = 5 * time.Second
+)
+
+const (
+	// A long poll takes a minute at most, a few failing in a row or
+	// polling blocked on full worker queues means the bot is wedged
+	MaxPollAge = 5 * time.Minute
+	// The schedule API is only requested by probes when idle for longer
+	UpstreamProbeAge = time.Minute
+	// Schedules cached for longer may be out of date, the cache is never
+	// refreshed yet
+	MaxCacheAge = 24 * time.Hour
+)
+
+var scheduleCache = metrics.Default.Counter("schedule_cache_lookups_total", "Lookups of group schedules in the cache, by result.", "result")
+
+const DefaultShutdownTimeout = 10 * time.Second
+
+// Updates waiting for each worker, polling pauses when a queue is full
+const WorkerQueueSize = 16
+
+// Incoming updates allowed per chat, on average per second and in a burst
+const (
+	UpdateRate = 1.0
+	UpdateBurst = 5
+)
+
+// Attempts at a fetch or a DB step failing with a transient error, e.g. the
+// DB or upstream being down, before the update is given up on
+const UpdateAttempts = 3
+
+// newMainApp sets the app up around its bot and store, nothing is
+// requested until load
+func newMainApp(bot tg.Bot, store db.Store, numWorkers int, whitelist []string, admins []string, logger *slog.Logger) *MainApp {
+	app := &MainApp{}
+	app.bot = bot
+	app.db = store
 	app.whitelist = whitelist
+	app.admins = admins
 	app.logger = logger
+	app.clock = common.SystemClock{}
+	app.metrics = router.NewMetrics(metrics.Default)
 	app.numWorkers = numWorkers
-	app.updChan = make(chan tg.Update, 1)
-	app.groupsSchedules = make(map[int]api.GroupResponse)
+	app.groupsSchedules = make(map[int]cachedSchedule)
+	// Polling hasn't started yet, but the bot isn't wedged either
+	app.lastPoll.Store(time.Now().UnixNano())
+	return app
+}
+
+func initMainApp(ctx context.Context, token string, numWorkers int, whitelist []string, admins []string, logger *slog.Logger) (app *MainApp, err error) {
 	// TODO handle invalid token
-	app.bot = tg.InitTgBot(token)
-	app.db, err = db.InitAppDb("postgres", db.PostgresConnStr(
+	bot := tg.InitTgBot(token)
+	if apiBase := os.Getenv("TG_API_BASE"); apiBase != "" {
+		bot = tg.InitTgBotWithBase(token, apiBase)
+	}
+	if scheduleBase := os.Getenv("SCHEDULE_API_BASE"); scheduleBase != "" {
+		api.Base = scheduleBase
+	}
+	appDb, err := db.InitAppDb(ctx, "postgres", db.PostgresConnStr(
 		os.Getenv("POSTGRES_USER"),
 		os.Getenv("POSTGRES_PASSWORD"),
 		os.Getenv("POSTGRES_HOST"),
@@ -81,89 +142,172 @@ func initMainApp(token string, numWorkers int, whitelist []string, logger IAppLo
 		err = errors.Join(common.ErrConnectDb, err)
 		return
 	}
-	app.db.Conn.SetMaxOpenConns(numWorkers)
-	app.db.Conn.SetMaxIdleConns(numWorkers) 
-	app.grouplist, err = api.GetGrouplist()
+	appDb.Conn.SetMaxOpenConns(numWorkers)
+	appDb.Conn.SetMaxIdleConns(numWorkers) 
+	app = newMainApp(bot, &appDb, numWorkers, whitelist, admins, logger)
+	err = app.load(ctx)
+	return
+}
+
+// load fetches what the app needs before serving updates
+func (app *MainApp) load(ctx context.Context) (err error) {
+	if err = app.loadCalendarDays(ctx); err != nil {
+		return
+	}
+	app.grouplist, err = api.GetGrouplist(ctx)
 	if err != nil {
 		err = errors.Join(common.ErrGetGroupList, err)
 	}
 	return
 }
 
-func defaultInlineKeyboard(group, week string) tg.ReplyKeyboardMarkup {
+// loadCalendarDays applies days set by admins on top of the calendar file
+func (app *MainApp) loadCalendarDays(ctx context.Context) error {
+	days, err := app.db.GetCalendarDays(ctx)
+	if err != nil {
+		return errors.Join(common.ErrLoadCalendar, err)
+	}
+	for _, d := range(days) {
+		calendar.Default.Set(calendar.Day{ Date: d.Day, Kind: calendar.Kind(d.Kind), As: d.WorksAs })
+	}
+	return nil
+}
+
+func defaultInlineKeyboard(lang i18n.Lang, group, week string) tg.ReplyKeyboardMarkup {
 	return tg.ReplyKeyboardMarkup{
 		Keyboard: [][]tg.KeyboardButton{
 			{
-				{ Text: common.ReplyKeyboardButtonToday },
-				{ Text: common.ReplyKeyboardButtonTomorrow },
+				{ Text: i18n.T(lang, i18n.ButtonNow) },
+				{ Text: i18n.T(lang, i18n.ButtonToday) },
+				{ Text: i18n.T(lang, i18n.ButtonTomorrow) },
 			},
 			{
-				{ Text: common.ReplyKeyboardButtonMonday },
-				{ Text: common.ReplyKeyboardButtonTuesday },
-				{ Text: common.ReplyKeyboardButtonWednesday },
-				{ Text: common.ReplyKeyboardButtonThursday },
-				{ Text: common.ReplyKeyboardButtonFriday },
-				{ Text: common.ReplyKeyboardButtonSaturday },
+				{ Text: i18n.T(lang, i18n.ButtonMonday) },
+				{ Text: i18n.T(lang, i18n.ButtonTuesday) },
+				{ Text: i18n.T(lang, i18n.ButtonWednesday) },
+				{ Text: i18n.T(lang, i18n.ButtonThursday) },
+				{ Text: i18n.T(lang, i18n.ButtonFriday) },
+				{ Text: i18n.T(lang, i18n.ButtonSaturday) },
 			},
 			{
-				{ Text: common.ReplyKeyboardButtonExams },
+				{ Text: i18n.T(lang, i18n.ButtonExams) },
 			},
 			{
-				{ Text: common.StatefulButton(common.ReplyKeyboardButtonChangeGroup, group ) },
+				{ Text: i18n.Stateful(lang, i18n.ButtonChangeGroup, group) },
 			},
 			{
 
-				{ Text: common.StatefulButton(common.ReplyKeyboardButtonChangeWeek, week ) },
+				{ Text: i18n.Stateful(lang, i18n.ButtonChangeWeek, week) },
+			},
+			{
+				{ Text: i18n.Stateful(lang, i18n.ButtonChangeLang, i18n.T(lang, i18n.LangName)) },
 			},
 		},
 		ResizeKeyboard: true,
 	}
 }
 
-func (app *MainApp) handleError(err error, upd tg.Update) {
+func (app *MainApp) isAdmin(upd tg.Update) bool {
+	return slices.Contains(app.admins, strconv.Itoa(upd.ChatId()))
+}
+
+// handleError tells the user what went wrong in lang, the one the pipeline
+// settled on. Updates that failed before the user was loaded have none,
+// their Telegram client's language is used then.
+func (app *MainApp) handleError(ctx context.Context, err error, upd tg.Update, lang i18n.Lang) {
 	if err == nil {
 		return
 	}
-	app.logger.Log(LogErr, err)
-	switch err {
-	case common.ErrNoUser:
-		tg.SendMsg(&app.bot, tg.BaseSentMessage{
-			Text: "Используйте команду /start",
+	if errors.Is(err, common.ErrInvalidUpdate) || errors.Is(err, common.ErrRateLimited) {
+		return
+	}
+	if lang == "" {
+		lang = i18n.Detect(upd.From().LanguageCode)
+	}
+	switch {
+	case errors.Is(err, common.ErrTgBlocked):
+		if err := app.db.SetUserActive(ctx, upd.ChatId(), false); err != nil {
+			logging.From(ctx).Error("Failed to deactivate user", logging.Err(errors.Join(common.ErrSetActive, err)))
+		}
+		return
+	case errors.Is(err, common.ErrNoUser):
+		tg.SendMsg(ctx, &app.bot, tg.BaseSentMessage{
+			Text: i18n.T(lang, i18n.ErrorNoUser),
+			ChatId: upd.ChatId(),
+		})
+		return
+	case errors.Is(err, common.ErrNotAdmin):
+		tg.SendMsg(ctx, &app.bot, tg.BaseSentMessage{
+			Text: i18n.T(lang, i18n.ErrorNotAdmin),
+			ChatId: upd.ChatId(),
+		})
+		return
+	case errors.Is(err, common.ErrNoGroupId):
+		tg.SendMsg(ctx, &app.bot, tg.BaseSentMessage{
+			Text: i18n.T(lang, i18n.ErrorNoGroup),
 			ChatId: upd.ChatId(),
 		})
 		return
-	case common.ErrNoGroupId:
-		tg.SendMsg(&app.bot, tg.BaseSentMessage{
-			Text: "Сначала выберите группу",
+	case errors.Is(err, common.ErrUnsupportedUpdate):
+		tg.SendMsg(ctx, &app.bot, tg.BaseSentMessage{
+			Text: i18n.T(lang, i18n.ErrorUnsupported),
 			ChatId: upd.ChatId(),
 		})
 		return
 	}
-	tg.SendMsg(&app.bot, tg.BaseSentMessage{
-		Text: "Произошла неизвестная ошибка",
+	tg.SendMsg(ctx, &app.bot, tg.BaseSentMessage{
+		Text: i18n.T(lang, i18n.ErrorUnknown),
 		ChatId: upd.ChatId(),
 	})
 }
 
+// editMsg treats re-sending the same content as success, it happens
+// whenever a user taps the same inline button twice.
+func editMsg[T tg.ChatMessage](ctx context.Context, bot *tg.Bot, m T) error {
+	err := tg.EditMsg(ctx, bot, m)
+	if errors.Is(err, common.ErrTgNotModified) {
+		return nil
+	}
+	return err
+}
+
+// retry repeats a step that is safe to repeat, see router.Retry. Sends
+// aren't, tg retries them itself where it can.
+func (app *MainApp) retry(ctx context.Context, fn func() error) error {
+	return router.Retry(ctx, UpdateAttempts, fn)
+}
+
+func (app *MainApp) reactivateUser(ctx context.Context, user db.User) error {
+	if user.Active {
+		return nil
+	}
+	err := app.retry(ctx, func() error {
+		return app.db.SetUserActive(ctx, user.Id, true)
+	})
+	if err != nil {
+		return errors.Join(common.ErrSetActive, err)
+	}
+	return nil
+}
 
-func (app *MainApp) initInstituteChoiceQuery(upd tg.Update, query common.CallbackData) error {
-	return tg.EditMsg(&app.bot, tg.EditedMessage{
-		Text: "Пожалуйста, выберите свое направление (институт)",
+func (app *MainApp) initInstituteChoiceQuery(ctx context.Context, upd tg.Update, query common.CallbackData, lang i18n.Lang) error {
+	return editMsg(ctx, &app.bot, tg.EditedMessage{
+		Text: i18n.T(lang, i18n.ChooseInstitute),
 		ChatId: upd.ChatId(),
 		MessageId: query.MessageId,
 		ReplyMarkup: app.grouplist.InlineButtons(),
 	})
 }
 
-func (app *MainApp) initInstituteChoice(upd tg.Update) error {
-	return tg.SendMsg(&app.bot, tg.SentMessage[tg.InlineKeyboardMarkup]{
-		Text: "Пожалуйста, выберите свое направление (институт)",
+func (app *MainApp) initInstituteChoice(ctx context.Context, upd tg.Update, lang i18n.Lang) error {
+	return tg.SendMsg(ctx, &app.bot, tg.SentMessage[tg.InlineKeyboardMarkup]{
+		Text: i18n.T(lang, i18n.ChooseInstitute),
 		ChatId: upd.ChatId(),
 		ReplyMarkup: app.grouplist.InlineButtons(),
 	})
 }
 
-func (app *MainApp) initGroupChoice(upd tg.Update, query common.CallbackData) error {
+func (app *MainApp) initGroupChoice(ctx context.Context, upd tg.Update, query common.CallbackData, lang i18n.Lang) error {
 	var groups api.GrouplistGroupList
 	for _, inst := range(app.grouplist) {
 		if inst.Abbreviate == query.Data {
@@ -171,33 +315,15 @@ func (app *MainApp) initGroupChoice(upd tg.Update, query common.CallbackData) er
 			break
 		}
 	}
-	return tg.EditMsg(&app.bot, tg.EditedMessage{
-		Text: "Пожалуйста, выберите свою группу",
+	return editMsg(ctx, &app.bot, tg.EditedMessage{
+		Text: i18n.T(lang, i18n.ChooseGroup),
 		MessageId: query.MessageId,
 		ChatId: upd.ChatId(),
-		ReplyMarkup: groups.InlineButtons(query.MessageId),
+		ReplyMarkup: groups.InlineButtons(query.MessageId, lang),
 	})
 }
 
-func (app *MainApp) handleCommand(upd tg.Update) error {
-	switch (upd.Message.Text[1:]) {
-		case "start":
-			_, err := app.db.GetUserById(upd.ChatId())
-			if errors.Is(err, common.ErrNoUser) {
-				err = app.db.CreateUser(upd.ChatId())
-				if err != nil {
-					return errors.Join(common.ErrCreateUser, err)
-				}
-			} else if err != nil {
-				return errors.Join(common.ErrGetUserById, err)
-			}
-			return app.initInstituteChoice(upd)
-		default:
-			return fmt.Errorf("Unsupported command: %s", upd.Message.Text[1:])
-	}
-}
-
-func (app *MainApp) acceptGroupChoice(upd tg.Update, user db.User, query common.CallbackData) error {
+func (app *MainApp) acceptGroupChoice(ctx context.Context, upd tg.Update, user db.User, query common.CallbackData, lang i18n.Lang) error {
 	groupId, _ := strconv.Atoi(query.Data)
 	var inst api.GrouplistInstitute
 	for _, i := range(app.grouplist) {
@@ -213,117 +339,210 @@ func (app *MainApp) acceptGroupChoice(upd tg.Update, user db.User, query common.
 			break
 		}
 	}
-	if err := app.db.SetUserGroup(user.Id, groupId, groupName); err != nil {
+	err := app.retry(ctx, func() error {
+		return app.db.SetUserGroup(ctx, user.Id, groupId, groupName)
+	})
+	if err != nil {
 		return errors.Join(common.ErrSetGroup, err)
 	}
-	err := tg.EditMsg(&app.bot, tg.BaseEditedMessage{
-		Text: "Группа изменена успешно",
+	err = editMsg(ctx, &app.bot, tg.BaseEditedMessage{
+		Text: i18n.T(lang, i18n.GroupChanged),
 		MessageId: query.MessageId,
 		ChatId: upd.ChatId(),
 	})
 	if err != nil {
 		return errors.Join(common.ErrEditMsg, err)
 	}
-	return tg.SendMsg(&app.bot, tg.SentMessage[tg.ReplyKeyboardMarkup]{
+	return tg.SendMsg(ctx, &app.bot, tg.SentMessage[tg.ReplyKeyboardMarkup]{
 		ChatId: upd.ChatId(),
 		Text: groupName,
-		ReplyMarkup: defaultInlineKeyboard(groupName, common.Weeknames[user.Week]),
+		ReplyMarkup: defaultInlineKeyboard(lang, groupName, i18n.Weekname(lang, user.Week)),
 	})
 }
 
-func (app *MainApp) acceptInstituteChoice(upd tg.Update, user db.User, query common.CallbackData) error {
-	if err := app.db.SetUserInstitute(user.Id, query.Data); err != nil {
+func (app *MainApp) acceptInstituteChoice(ctx context.Context, upd tg.Update, user db.User, query common.CallbackData, lang i18n.Lang) error {
+	err := app.retry(ctx, func() error {
+		return app.db.SetUserInstitute(ctx, user.Id, query.Data)
+	})
+	if err != nil {
 		return errors.Join(common.ErrSetUserInst, err)
 	}
-	err := app.initGroupChoice(upd, query)
+	err = app.initGroupChoice(ctx, upd, query, lang)
 	if err != nil {
 		return errors.Join(common.ErrInitGroupChoice, err)
 	}
 	return nil
 }
  
-func (app *MainApp) handleCallbackQuery(upd tg.Update) error {
-	query := common.ParseCallbackData(upd.CallbackQuery.Data)
-	user, err := app.db.GetUserById(upd.ChatId())
+func (app *MainApp) answerCallbackQuery(ctx context.Context, upd tg.Update, text string) {
+	err := tg.AnswerCallbackQuery(ctx, &app.bot, tg.AnsweredCallbackQuery{
+		CallbackQueryId: upd.CallbackQuery.Id,
+		Text: text,
+	})
 	if err != nil {
-		return errors.Join(common.ErrGetUserById, err)
+		logging.From(ctx).Warn("Failed to answer callback query", logging.Err(errors.Join(common.ErrAnswerQuery, err)))
 	}
-	if (user == db.User{}) {
-		return common.ErrNoUser
-	}
-	if query.MessageId == 0 {
-		query.MessageId = upd.CallbackQuery.Message.MessageId
-	}
-	switch (query.Typ) {
-	case common.CallbackQueryTypeInstitute:
-		err = app.acceptInstituteChoice(upd, user, query)
-		if err != nil {
-			return errors.Join(common.ErrAcceptInstChoice, err)
-		}
-	case common.CallbackQueryTypeGroups:
-		err = app.acceptGroupChoice(upd, user, query)
-		if err != nil {
-			return errors.Join(common.ErrAcceptGroupChoice, err)
-		}
-	case common.CallbackQueryTypeWeek:
-		err = app.acceptWeekChoice(upd, user, query)
-		if err != nil {
-			return errors.Join(common.ErrAcceptWeekChoice, err)
-		}
-	case common.CallbackQueryTypeChangeInstitute:
-		err = app.initInstituteChoiceQuery(upd, query)
-		if err != nil {
-			return errors.Join(common.ErrInitInstChoice, err)
-		}
-	default:
-		return fmt.Errorf("Unsupported callback query typ: %s", query.Typ)
-	}
-	return nil
 }
 
-func (app *MainApp) _getSchedule(user db.User) (schedule api.GroupResponse, err error) {
+func (app *MainApp) _getSchedule(ctx context.Context, user db.User) (schedule api.GroupResponse, err error) {
 	if user.GroupId == 0 {
 		err = common.ErrNoGroupId
 		return
 	}
-	var ok bool
-	if schedule, ok = app.groupsSchedules[user.GroupId]; !ok {
-		schedule, err = api.GetGroup(user.GroupId)
-		if err != nil {
-			err = errors.Join(common.ErrSetGroup, err)
-			return
-		}
-		app.groupsSchedules[user.GroupId] = schedule
+	app.schedulesMu.RLock()
+	cached, ok := app.groupsSchedules[user.GroupId]
+	app.schedulesMu.RUnlock()
+	if ok {
+		scheduleCache.Inc("hit")
+		return cached.GroupResponse, nil
 	}
+	scheduleCache.Inc("miss")
+	err = app.retry(ctx, func() (err error) {
+		schedule, err = api.GetGroup(ctx, user.GroupId)
+		return
+	})
+	if err != nil {
+		err = errors.Join(common.ErrSetGroup, err)
+		return
+	}
+	if err := schedule.Validate(); err != nil {
+		logging.From(ctx).Warn("Upstream schedule has problems", "group_id", user.GroupId, logging.Err(err))
+	}
+	app.schedulesMu.Lock()
+	app.groupsSchedules[user.GroupId] = cachedSchedule{ schedule, time.Now() }
+	app.schedulesMu.Unlock()
 	return
 }
 
-func (app *MainApp) getSchedule(upd tg.Update, user db.User, t time.Time) error {
-	s, err := app._getSchedule(user)
+func (app *MainApp) getSchedule(ctx context.Context, upd tg.Update, user db.User, lang i18n.Lang, t time.Time) error {
+	s, err := app._getSchedule(ctx, user)
 	if err != nil {
 		return errors.Join(common.ErrGetSchedule, err)
 	}
-	return tg.SendMsg(&app.bot, tg.BaseSentMessage{
+	text, err := s.ByDate(tg.HTML, lang, t, user.Week)
+	if err != nil {
+		return err
+	}
+	return tg.SendMsg(ctx, &app.bot, tg.BaseSentMessage{
 		ChatId: upd.ChatId(),
-		Text: s.ByDate(t, user.Week),
+		Text: text,
+		ParseMode: tg.HTML.ParseMode(),
 	})
 }
 
-func (app *MainApp) getExams(upd tg.Update, user db.User) error {
-	s, err := app._getSchedule(user)
+// getToday falls back to the exams view during session, unless there
+// still are classes on the day
+func (app *MainApp) getToday(ctx context.Context, upd tg.Update, user db.User, lang i18n.Lang, t time.Time) error {
+	s, err := app._getSchedule(ctx, user)
 	if err != nil {
 		return errors.Join(common.ErrGetSchedule, err)
 	}
-	return tg.SendMsg(&app.bot, tg.BaseSentMessage{
+	if s.InSession(t) && len(s.Day(t, user.Week).Lessons) == 0 {
+		return app.getExams(ctx, upd, user, lang)
+	}
+	return app.getSchedule(ctx, upd, user, lang, t)
+}
+
+func (app *MainApp) getNow(ctx context.Context, upd tg.Update, user db.User, lang i18n.Lang) error {
+	s, err := app._getSchedule(ctx, user)
+	if err != nil {
+		return errors.Join(common.ErrGetSchedule, err)
+	}
+	text, err := s.NowReadable(tg.HTML, lang, app.clock.Now(), user.Week)
+	if err != nil {
+		return err
+	}
+	return tg.SendMsg(ctx, &app.bot, tg.BaseSentMessage{
 		ChatId: upd.ChatId(),
-		Text: s.Exams(),
+		Text: text,
+		ParseMode: tg.HTML.ParseMode(),
 	})
 }
 
-func (app *MainApp) initWeekChoice(upd tg.Update) error {
-	return tg.SendMsg(&app.bot, tg.SentMessage[tg.InlineKeyboardMarkup]{
+func (app *MainApp) getExams(ctx context.Context, upd tg.Update, user db.User, lang i18n.Lang) error {
+	s, err := app._getSchedule(ctx, user)
+	if err != nil {
+		return errors.Join(common.ErrGetSchedule, err)
+	}
+	text, err := s.Exams(tg.HTML, lang, app.clock.Now())
+	if err != nil {
+		return err
+	}
+	return tg.SendMsg(ctx, &app.bot, tg.BaseSentMessage{
 		ChatId: upd.ChatId(),
-		Text: "Пожалуйста, выберите неделю",
+		Text: text,
+		ParseMode: tg.HTML.ParseMode(),
+	})
+}
+
+func (app *MainApp) getWeek(ctx context.Context, upd tg.Update, user db.User, lang i18n.Lang) error {
+	s, err := app._getSchedule(ctx, user)
+	if err != nil {
+		return errors.Join(common.ErrGetSchedule, err)
+	}
+	text := i18n.T(lang, i18n.WeekNone)
+	if week, ok := s.CurrentWeek(app.clock.Now()); ok {
+		text = i18n.T(lang, i18n.WeekNow, week.Number, strings.ToLower(i18n.Weekname(lang, week.Parity)))
+	}
+	return tg.SendMsg(ctx, &app.bot, tg.BaseSentMessage{
+		ChatId: upd.ChatId(),
+		Text: text,
+	})
+}
+
+func (app *MainApp) setShortDay(ctx context.Context, upd tg.Update, lang i18n.Lang, args []string) error {
+	if !app.isAdmin(upd) {
+		return common.ErrNotAdmin
+	}
+	usage := tg.BaseSentMessage{
+		ChatId: upd.ChatId(),
+		Text: i18n.T(lang, i18n.CommandUsage, "/shortday YYYY-MM-DD [off]"),
+	}
+	off := len(args) == 2 && args[1] == "off"
+	if len(args) != 1 && !off {
+		return tg.SendMsg(ctx, &app.bot, usage)
+	}
+	date, err := calendar.ParseDate(args[0])
+	if err != nil {
+		return tg.SendMsg(ctx, &app.bot, usage)
+	}
+	// Holidays and transferred days come from the production calendar,
+	// a shortened day is no business of theirs
+	text := ""
+	switch d, _ := calendar.Default.Get(date); d.Kind {
+	case calendar.KindHoliday:
+		text = i18n.T(lang, i18n.ShortDayHoliday, args[0])
+	case calendar.KindWorkday:
+		text = i18n.T(lang, i18n.ShortDayWorkday, args[0])
+	}
+	if text != "" {
+		return tg.SendMsg(ctx, &app.bot, tg.BaseSentMessage{ ChatId: upd.ChatId(), Text: text })
+	}
+	// Turning a day off is stored too, it must beat the calendar file on
+	// the next start
+	day := calendar.Day{ Date: args[0], Kind: calendar.KindShort }
+	text = i18n.T(lang, i18n.ShortDaySet, args[0])
+	if off {
+		day.Kind = calendar.KindRegular
+		text = i18n.T(lang, i18n.ShortDayUnset, args[0])
+	}
+	err = app.retry(ctx, func() error {
+		return app.db.SetCalendarDay(ctx, db.CalendarDay{ Day: day.Date, Kind: string(day.Kind) })
+	})
+	if err != nil {
+		return err
+	}
+	calendar.Default.Set(day)
+	return tg.SendMsg(ctx, &app.bot, tg.BaseSentMessage{
+		ChatId: upd.ChatId(),
+		Text: text,
+	})
+}
+
+func (app *MainApp) initWeekChoice(ctx context.Context, upd tg.Update, lang i18n.Lang) error {
+	return tg.SendMsg(ctx, &app.bot, tg.SentMessage[tg.InlineKeyboardMarkup]{
+		ChatId: upd.ChatId(),
+		Text: i18n.T(lang, i18n.ChooseWeek),
 		ReplyMarkup: tg.InlineKeyboardMarkup{
 			InlineKeyboard: [][]tg.InlineKeyboardButton{
 				{
@@ -337,7 +556,7 @@ func (app *MainApp) initWeekChoice(upd tg.Update) error {
 					}.ToJson() },
 				},
 				{
-					{ Text: "Текущая", CallbackData: common.CallbackData{
+					{ Text: i18n.Weekname(lang, 0), CallbackData: common.CallbackData{
 						Typ: common.CallbackQueryTypeWeek,
 						Data: "0",
 					}.ToJson() },
@@ -347,175 +566,624 @@ func (app *MainApp) initWeekChoice(upd tg.Update) error {
 	})
 }
 
-func (app *MainApp) acceptWeekChoice(upd tg.Update, user db.User, query common.CallbackData) error {
+func (app *MainApp) acceptWeekChoice(ctx context.Context, upd tg.Update, user db.User, query common.CallbackData, lang i18n.Lang) error {
 	week, err := strconv.Atoi(query.Data)
 	if err != nil {
 		return errors.Join(common.ErrWeekFromData, err)
 	}
-	err = app.db.SetUserWeek(user.Id, week)
+	err = app.retry(ctx, func() error {
+		return app.db.SetUserWeek(ctx, user.Id, week)
+	})
 	if err != nil {
 		return errors.Join(common.ErrSetWeek, err)
 	}
-	err = tg.EditMsg(&app.bot, tg.BaseEditedMessage{
+	err = editMsg(ctx, &app.bot, tg.BaseEditedMessage{
 		ChatId: upd.ChatId(),
 		MessageId: query.MessageId,
-		Text: "Неделя сменена успешно",
+		Text: i18n.T(lang, i18n.WeekChanged),
 	})
 	if err != nil {
 		return errors.Join(common.ErrEditMsg, err)
 	}
-	weekName := common.Weeknames[week]
-	return tg.SendMsg(&app.bot, tg.SentMessage[tg.ReplyKeyboardMarkup]{
+	weekName := i18n.Weekname(lang, week)
+	return tg.SendMsg(ctx, &app.bot, tg.SentMessage[tg.ReplyKeyboardMarkup]{
 		ChatId: upd.ChatId(),
 		Text: weekName,
-		ReplyMarkup: defaultInlineKeyboard(user.GroupName, weekName),
+		ReplyMarkup: defaultInlineKeyboard(lang, user.GroupName, weekName),
 	})
 }
 
-func (app *MainApp) handleMessage(upd tg.Update) error {
-	var err error
-	if upd.Message.Text[0] == '/' {
-		err = app.handleCommand(upd)
-		if err != nil {
-			return errors.Join(common.ErrCommand, err)
+func (app *MainApp) initLangChoice(ctx context.Context, upd tg.Update, lang i18n.Lang) error {
+	var row []tg.InlineKeyboardButton
+	for _, l := range(i18n.Langs) {
+		row = append(row, tg.InlineKeyboardButton{
+			Text: i18n.T(l, i18n.LangName),
+			CallbackData: common.CallbackData{
+				Typ: common.CallbackQueryTypeLang,
+				Data: string(l),
+			}.ToJson(),
+		})
+	}
+	return tg.SendMsg(ctx, &app.bot, tg.SentMessage[tg.InlineKeyboardMarkup]{
+		ChatId: upd.ChatId(),
+		Text: i18n.T(lang, i18n.ChooseLang),
+		ReplyMarkup: tg.InlineKeyboardMarkup{
+			InlineKeyboard: [][]tg.InlineKeyboardButton{ row },
+		},
+	})
+}
+
+func (app *MainApp) acceptLangChoice(ctx context.Context, upd tg.Update, user db.User, query common.CallbackData, lang i18n.Lang) error {
+	err := app.retry(ctx, func() error {
+		return app.db.SetUserLang(ctx, user.Id, string(lang))
+	})
+	if err != nil {
+		return errors.Join(common.ErrSetLang, err)
+	}
+	err = editMsg(ctx, &app.bot, tg.BaseEditedMessage{
+		ChatId: upd.ChatId(),
+		MessageId: query.MessageId,
+		Text: i18n.T(lang, i18n.LangChanged),
+	})
+	if err != nil {
+		return errors.Join(common.ErrEditMsg, err)
+	}
+	return tg.SendMsg(ctx, &app.bot, tg.SentMessage[tg.ReplyKeyboardMarkup]{
+		ChatId: upd.ChatId(),
+		Text: i18n.T(lang, i18n.LangName),
+		ReplyMarkup: defaultInlineKeyboard(lang, user.GroupName, i18n.Weekname(lang, user.Week)),
+	})
+}
+
+const (
+	reminderOn = "on"
+	reminderOff = "off"
+)
+
+// remindersKeyboard buttons carry the state they switch to rather than a
+// toggle, tapping one twice or handling it twice changes nothing
+func remindersKeyboard(lang i18n.Lang, user db.User) tg.InlineKeyboardMarkup {
+	toggle := func(key i18n.Key, on bool, slot api.ReminderSlot) []tg.InlineKeyboardButton {
+		mark, target := "❌", reminderOn
+		if on {
+			mark, target = "✅", reminderOff
 		}
+		return []tg.InlineKeyboardButton{{
+			Text: mark + " " + i18n.T(lang, key),
+			CallbackData: common.CallbackData{
+				Typ: common.CallbackQueryTypeReminders,
+				Data: string(slot) + ":" + target,
+			}.ToJson(),
+		}}
+	}
+	return tg.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tg.InlineKeyboardButton{
+			toggle(i18n.ButtonRemindEvening, user.RemindEvening, api.ReminderSlotEvening),
+			toggle(i18n.ButtonRemindMorning, user.RemindMorning, api.ReminderSlotMorning),
+		},
+	}
+}
+
+func (app *MainApp) initRemindersChoice(ctx context.Context, upd tg.Update, user db.User, lang i18n.Lang) error {
+	return tg.SendMsg(ctx, &app.bot, tg.SentMessage[tg.InlineKeyboardMarkup]{
+		ChatId: upd.ChatId(),
+		Text: i18n.T(lang, i18n.Reminders),
+		ReplyMarkup: remindersKeyboard(lang, user),
+	})
+}
+
+func (app *MainApp) acceptRemindersToggle(ctx context.Context, upd tg.Update, user db.User, query common.CallbackData, lang i18n.Lang) error {
+	slot, target, found := strings.Cut(query.Data, ":")
+	var on *bool
+	switch (api.ReminderSlot(slot)) {
+	case api.ReminderSlotEvening:
+		on = &user.RemindEvening
+	case api.ReminderSlotMorning:
+		on = &user.RemindMorning
+	default:
 		return nil
 	}
-	user, err := app.db.GetUserById(upd.ChatId())
+	// Keyboards sent before buttons carried their target only say which
+	// slot to flip
+	if !found {
+		target = reminderOn
+		if *on {
+			target = reminderOff
+		}
+	}
+	*on = target == reminderOn
+	err := app.retry(ctx, func() error {
+		return app.db.SetUserReminders(ctx, user.Id, user.RemindEvening, user.RemindMorning)
+	})
 	if err != nil {
-		return errors.Join(common.ErrGetUserById, err)
+		return err
 	}
-	if (user == db.User{}) {
-		return common.ErrNoUser
+	return editMsg(ctx, &app.bot, tg.EditedMessage{
+		ChatId: upd.ChatId(),
+		MessageId: query.MessageId,
+		Text: i18n.T(lang, i18n.Reminders),
+		ReplyMarkup: remindersKeyboard(lang, user),
+	})
+}
+
+// sendReminders sends every reminder due at t. Each one is recorded
+// before sending, so that a restart never repeats it.
+func (app *MainApp) sendReminders(ctx context.Context, t time.Time) error {
+	if err := app.db.PruneSentReminders(ctx, common.StartOfDay(t).Format(api.DateLayout)); err != nil {
+		app.logger.Warn("Failed to prune sent reminders", logging.Err(err))
+	}
+	users, err := app.db.GetReminderUsers(ctx)
+	if err != nil {
+		return err
 	}
-	t := time.Now().Add(time.Hour * 3);
-	if common.StartsWith(upd.Message.Text, common.ReplyKeyboardButtonChangeGroup) {
-		err = app.initInstituteChoice(upd)
+	for _, user := range(users) {
+		s, err := app._getSchedule(ctx, user)
 		if err != nil {
-			return errors.Join(common.ErrInitInstChoice, err)
+			app.logger.Warn("Failed to get schedule for reminders", "chat_id", user.Id, logging.Err(err))
+			continue
+		}
+		lang := i18n.Parse(user.Lang)
+		for _, e := range(s.ExamEvents(t)) {
+			for _, slot := range([]api.ReminderSlot{ api.ReminderSlotEvening, api.ReminderSlotMorning }) {
+				if slot == api.ReminderSlotEvening && !user.RemindEvening ||
+					slot == api.ReminderSlotMorning && !user.RemindMorning ||
+					!e.ReminderDue(slot, t) {
+					continue
+				}
+				if err := app.sendReminder(ctx, user, lang, s, e, slot); err != nil {
+					app.logger.Warn("Failed to send reminder", "chat_id", user.Id, "event", e.Key(user.GroupId), "slot", slot, logging.Err(err))
+				}
+			}
 		}
-		return nil
 	}
-	if common.StartsWith(upd.Message.Text, common.ReplyKeyboardButtonChangeWeek) {
-		err = app.initWeekChoice(upd)
-		if err != nil {
-			return errors.Join(common.ErrInitWeekChoice, err)
+	return nil
+}
+
+func (app *MainApp) sendReminder(ctx context.Context, user db.User, lang i18n.Lang, s api.GroupResponse, e api.ExamEvent, slot api.ReminderSlot) error {
+	key := e.Key(user.GroupId)
+	sent, err := app.db.MarkReminderSent(ctx, user.Id, key, string(slot), e.Date.Format(api.DateLayout))
+	if err != nil || !sent {
+		return err
+	}
+	text, err := s.Reminder(tg.HTML, lang, e, slot)
+	if err == nil {
+		err = tg.SendMsg(ctx, &app.bot, tg.BaseSentMessage{
+			ChatId: user.Id,
+			Text: text,
+			ParseMode: tg.HTML.ParseMode(),
+		})
+	}
+	switch {
+	case errors.Is(err, common.ErrTgBlocked):
+		return errors.Join(err, app.db.SetUserActive(ctx, user.Id, false))
+	case err != nil:
+		// Left for the next tick to retry
+		return errors.Join(err, app.db.UnmarkReminderSent(ctx, user.Id, key, string(slot)))
+	}
+	return nil
+}
+
+func (app *MainApp) sendRemindersSafe(ctx context.Context, t time.Time) (err error) {
+	defer router.RecoverErr(&err)
+	return app.sendReminders(ctx, t)
+}
+
+// RunReminders checks for due reminders every minute until stop is done,
+// sending them with ctx.
+func (app *MainApp) RunReminders(stop context.Context, ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := app.sendRemindersSafe(ctx, app.clock.Now()); err != nil {
+			app.logger.Error("Failed to send reminders", logging.Err(errors.Join(common.ErrSendReminders, err)))
 		}
+	}
+}
+
+// wrapErr is errors.Join for handler results, nil stays nil
+func wrapErr(sentinel error, err error) error {
+	if err == nil {
 		return nil
 	}
-	switch (upd.Message.Text) {
-	case common.ReplyKeyboardButtonExams:
-		err = app.getExams(upd, user)
+	return errors.Join(sentinel, err)
+}
+
+func (app *MainApp) start(c *router.Context) error {
+	if !c.HasUser {
+		c.User.Lang = string(c.Lang)
+		err := app.retry(c.Ctx, func() error {
+			return app.db.CreateUser(c.Ctx, c.ChatId(), c.User.Lang)
+		})
 		if err != nil {
-			return errors.Join(common.ErrGetExams, err)
+			return errors.Join(common.ErrCreateUser, err)
 		}
-	case common.ReplyKeyboardButtonToday:
-		user.Week = 0
-		err = app.getSchedule(upd, user, t)
-		if err != nil {
-			return errors.Join(common.ErrGetToday, err)
+	}
+	return app.initInstituteChoice(c.Ctx, c.Update, c.Lang)
+}
+
+// reactivate marks users who blocked the bot and came back as active
+func (app *MainApp) reactivate(next router.Handler) router.Handler {
+	return func(c *router.Context) error {
+		if c.HasUser {
+			if err := app.reactivateUser(c.Ctx, c.User); err != nil {
+				return err
+			}
 		}
-	case common.ReplyKeyboardButtonTomorrow:
-		user.Week = 0
-		err = app.getSchedule(upd, user, t.AddDate(0, 0, 1))
-		if err != nil {
-			return errors.Join(common.ErrGetTomorrow, err)
+		return next(c)
+	}
+}
+
+// answerCallback answers callback queries even on failure, the error
+// itself is reported by handleError
+func (app *MainApp) answerCallback(next router.Handler) router.Handler {
+	return func(c *router.Context) error {
+		if c.Update.IsCallbackQuery() {
+			defer func() {
+				app.answerCallbackQuery(c.Ctx, c.Update, c.Toast)
+			}()
 		}
-	case common.ReplyKeyboardButtonMonday:
-		err = app.getSchedule(upd, user, t.AddDate(0, 0, -int(t.Weekday()) + 1))
-		if err != nil {
-			return errors.Join(common.ErrGetMon, err)
+		return next(c)
+	}
+}
+
+// rateLimited asks the user to slow down, in the language of their
+// Telegram client: the user isn't loaded for dropped updates
+func (app *MainApp) rateLimited(c *router.Context) error {
+	text := i18n.T(i18n.Detect(c.Update.From().LanguageCode), i18n.ErrorRateLimited)
+	if c.Update.IsCallbackQuery() {
+		c.Toast = text
+		return nil
+	}
+	return tg.SendMsg(c.Ctx, &app.bot, tg.BaseSentMessage{
+		ChatId: c.ChatId(),
+		Text: text,
+	})
+}
+
+// weekdayDate is the given day of t's week, 1 being Monday. On Sunday
+// the week ahead is meant.
+func weekdayDate(t time.Time, weekday int) time.Time {
+	return t.AddDate(0, 0, -int(t.Weekday()) + weekday)
+}
+
+// weekday shows the given day of the current week
+func (app *MainApp) weekday(weekday int, sentinel error) router.Handler {
+	return func(c *router.Context) error {
+		return wrapErr(sentinel, app.getSchedule(c.Ctx, c.Update, c.User, c.Lang, weekdayDate(app.clock.Now(), weekday)))
+	}
+}
+
+func (app *MainApp) routes() *router.Router {
+	r := router.New()
+	user := router.RequireUser()
+
+	r.Command("start", app.start)
+	r.Command("week", func(c *router.Context) error {
+		return wrapErr(common.ErrGetWeek, app.getWeek(c.Ctx, c.Update, c.User, c.Lang))
+	}, user)
+	r.Command("language", func(c *router.Context) error {
+		return wrapErr(common.ErrInitLangChoice, app.initLangChoice(c.Ctx, c.Update, c.Lang))
+	}, user)
+	r.Command("reminders", func(c *router.Context) error {
+		return wrapErr(common.ErrInitReminders, app.initRemindersChoice(c.Ctx, c.Update, c.User, c.Lang))
+	}, user)
+	r.Command("shortday", func(c *router.Context) error {
+		return wrapErr(common.ErrSetCalendarDay, app.setShortDay(c.Ctx, c.Update, c.Lang, c.Args))
+	})
+
+	r.Callback(common.CallbackQueryTypeInstitute, func(c *router.Context) error {
+		return wrapErr(common.ErrAcceptInstChoice, app.acceptInstituteChoice(c.Ctx, c.Update, c.User, c.Query, c.Lang))
+	}, user)
+	r.Callback(common.CallbackQueryTypeGroups, func(c *router.Context) error {
+		if err := app.acceptGroupChoice(c.Ctx, c.Update, c.User, c.Query, c.Lang); err != nil {
+			return errors.Join(common.ErrAcceptGroupChoice, err)
 		}
-	case common.ReplyKeyboardButtonTuesday:
-		err = app.getSchedule(upd, user, t.AddDate(0, 0, -int(t.Weekday()) + 2))
-		if err != nil {
-			return errors.Join(common.ErrGetTue, err)
+		c.Toast = i18n.T(c.Lang, i18n.ToastGroupChanged)
+		return nil
+	}, user)
+	r.Callback(common.CallbackQueryTypeWeek, func(c *router.Context) error {
+		if err := app.acceptWeekChoice(c.Ctx, c.Update, c.User, c.Query, c.Lang); err != nil {
+			return errors.Join(common.ErrAcceptWeekChoice, err)
 		}
-	case common.ReplyKeyboardButtonWednesday:
-		err = app.getSchedule(upd, user, t.AddDate(0, 0, -int(t.Weekday()) + 3))
-		if err != nil {
-			return errors.Join(common.ErrGetWed, err)
+		c.Toast = i18n.T(c.Lang, i18n.ToastWeekChanged)
+		return nil
+	}, user)
+	r.Callback(common.CallbackQueryTypeLang, func(c *router.Context) error {
+		c.Lang = i18n.Parse(c.Query.Data)
+		if err := app.acceptLangChoice(c.Ctx, c.Update, c.User, c.Query, c.Lang); err != nil {
+			return errors.Join(common.ErrAcceptLangChoice, err)
 		}
-	case common.ReplyKeyboardButtonThursday:
-		err = app.getSchedule(upd, user, t.AddDate(0, 0, -int(t.Weekday()) + 4))
-		if err != nil {
-			return errors.Join(common.ErrGetThu, err)
+		c.Toast = i18n.T(c.Lang, i18n.ToastLangChanged)
+		return nil
+	}, user)
+	r.Callback(common.CallbackQueryTypeReminders, func(c *router.Context) error {
+		return wrapErr(common.ErrSetReminders, app.acceptRemindersToggle(c.Ctx, c.Update, c.User, c.Query, c.Lang))
+	}, user)
+	r.Callback(common.CallbackQueryTypeChangeInstitute, func(c *router.Context) error {
+		return wrapErr(common.ErrInitInstChoice, app.initInstituteChoiceQuery(c.Ctx, c.Update, c.Query, c.Lang))
+	}, user)
+
+	r.StatefulButton(i18n.ButtonChangeGroup, func(c *router.Context) error {
+		return wrapErr(common.ErrInitInstChoice, app.initInstituteChoice(c.Ctx, c.Update, c.Lang))
+	}, user)
+	r.StatefulButton(i18n.ButtonChangeWeek, func(c *router.Context) error {
+		return wrapErr(common.ErrInitWeekChoice, app.initWeekChoice(c.Ctx, c.Update, c.Lang))
+	}, user)
+	r.StatefulButton(i18n.ButtonChangeLang, func(c *router.Context) error {
+		return wrapErr(common.ErrInitLangChoice, app.initLangChoice(c.Ctx, c.Update, c.Lang))
+	}, user)
+	r.Button(i18n.ButtonExams, func(c *router.Context) error {
+		return wrapErr(common.ErrGetExams, app.getExams(c.Ctx, c.Update, c.User, c.Lang))
+	}, user)
+	r.Button(i18n.ButtonNow, func(c *router.Context) error {
+		c.User.Week = 0
+		return wrapErr(common.ErrGetNow, app.getNow(c.Ctx, c.Update, c.User, c.Lang))
+	}, user)
+	r.Button(i18n.ButtonToday, func(c *router.Context) error {
+		c.User.Week = 0
+		return wrapErr(common.ErrGetToday, app.getToday(c.Ctx, c.Update, c.User, c.Lang, app.clock.Now()))
+	}, user)
+	r.Button(i18n.ButtonTomorrow, func(c *router.Context) error {
+		c.User.Week = 0
+		return wrapErr(common.ErrGetTomorrow, app.getSchedule(c.Ctx, c.Update, c.User, c.Lang, app.clock.Now().AddDate(0, 0, 1)))
+	}, user)
+	r.Button(i18n.ButtonMonday, app.weekday(1, common.ErrGetMon), user)
+	r.Button(i18n.ButtonTuesday, app.weekday(2, common.ErrGetTue), user)
+	r.Button(i18n.ButtonWednesday, app.weekday(3, common.ErrGetWed), user)
+	r.Button(i18n.ButtonThursday, app.weekday(4, common.ErrGetThu), user)
+	r.Button(i18n.ButtonFriday, app.weekday(5, common.ErrGetFri), user)
+	r.Button(i18n.ButtonSaturday, app.weekday(6, common.ErrGetSat), user)
+	return r
+}
+
+// pipeline is everything an update goes through, in order
+func (app *MainApp) pipeline() router.Handler {
+	return router.Chain(
+		app.routes().Handle,
+		router.Logging(app.logger),
+		app.metrics.Middleware(),
+		router.Recover(),
+		router.Validate(),
+		router.Whitelist(app.whitelist),
+		// Ahead of the rate limit, dropped queries still stop the spinner
+		app.answerCallback,
+		router.RateLimit(UpdateRate, UpdateBurst, app.rateLimited),
+		router.LoadUser(app.db, UpdateAttempts),
+		app.reactivate,
+	)
+}
+
+// GetUpdates polls until ctx is done, handing updates to d. Polling
+// starts from the first update not handled yet, updates Telegram sends
+// again while they are in flight, or that were handled before a restart,
+// are skipped.
+func (app *MainApp) GetUpdates(ctx context.Context, d *router.Dispatcher) {
+	backoff := tg.NewBackoff()
+	for ctx.Err() == nil {
+		app.bot.SetLastUpdate(app.offsets.Offset())
+		upds, err := app.bot.GetUpdates(ctx)
+		if ctx.Err() != nil {
+			break
 		}
-	case common.ReplyKeyboardButtonFriday:
-		err = app.getSchedule(upd, user, t.AddDate(0, 0, -int(t.Weekday()) + 5))
 		if err != nil {
-			return errors.Join(common.ErrGetFri, err)
+			app.logger.Error("Failed to get updates", logging.Err(errors.Join(common.ErrGetUpdates, err)))
+			select {
+			case <-time.After(backoff.Next()):
+			case <-ctx.Done():
+			}
+			continue
 		}
-	case common.ReplyKeyboardButtonSaturday:
-		err = app.getSchedule(upd, user, t.AddDate(0, 0, -int(t.Weekday()) + 6))
-		if err != nil {
-			return errors.Join(common.ErrGetSat, err)
+		backoff.Reset()
+		app.lastPoll.Store(time.Now().UnixNano())
+		fresh := 0
+		for _, upd := range upds {
+			if !app.offsets.Track(upd.UpdateId) {
+				continue
+			}
+			processed, err := app.db.IsUpdateProcessed(ctx, upd.UpdateId)
+			if err != nil {
+				app.logger.Warn("Failed to check if update was handled", "update_id", upd.UpdateId, logging.Err(err))
+			}
+			if processed {
+				app.commitUpdate(ctx, upd.UpdateId)
+				continue
+			}
+			// The rest come again on the next start
+			if d.Dispatch(ctx, upd) != nil {
+				return
+			}
+			fresh++
+		}
+		// Telegram answers right away while updates are unconfirmed, wait
+		// for one to be handled instead of spinning
+		if fresh == 0 && len(upds) > 0 {
+			select {
+			case <-app.offsets.Changed():
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
 		}
 	}
-	return nil
 }
 
-func (app *MainApp) handleUpdate(upd tg.Update) error {
-	var err error
-	if upd.IsCallbackQuery() {
-		err = app.handleCallbackQuery(upd)
-		if err != nil {
-			err = errors.Join(common.ErrHandleQuery, err)
-		}
-		return err 
+// commitUpdate records the update as handled and persists the offset if
+// it moved
+func (app *MainApp) commitUpdate(ctx context.Context, id int) {
+	if err := app.db.MarkUpdateProcessed(ctx, id); err != nil {
+		app.logger.Warn("Failed to mark update handled", "update_id", id, logging.Err(errors.Join(common.ErrUpdateOffset, err)))
 	}
-	err = app.handleMessage(upd)
-	if err != nil {
-		err = errors.Join(common.ErrHandleMessage, err)
+	if _, moved := app.offsets.Done(id); !moved {
+		return
+	}
+	// Workers finish in any order, the latest offset is written last
+	app.offsetMu.Lock()
+	defer app.offsetMu.Unlock()
+	if err := app.db.SetUpdateOffset(ctx, app.offsets.Offset()); err != nil {
+		app.logger.Warn("Failed to save update offset", logging.Err(errors.Join(common.ErrUpdateOffset, err)))
 	}
-	return err
 }
 
-func (app *MainApp) NewWorker() {
-	for upd := range app.updChan {
-		if len(app.whitelist) > 0 && !slices.Contains(app.whitelist, strconv.Itoa(upd.ChatId())) {
-			continue	
+// Run serves updates until stop is done, then drains the workers. ctx is
+// what handlers run with, it outlives stop so that updates in flight
+// still get answered, cancelling it aborts them.
+func (app *MainApp) Run(stop context.Context, ctx context.Context) {
+	offset, err := app.db.GetUpdateOffset(stop)
+	if err != nil {
+		app.logger.Warn("Failed to load update offset, starting over", logging.Err(errors.Join(common.ErrUpdateOffset, err)))
+	}
+	app.offsets = router.NewOffsets(offset)
+	handler := app.pipeline()
+	d := router.NewDispatcher(app.numWorkers, WorkerQueueSize, func(upd tg.Update) {
+		c := &router.Context{ Ctx: ctx, Update: upd }
+		err := handler(c)
+		app.handleError(c.Ctx, err, upd, c.Lang)
+		// Aborted on shutdown, handled again on the next start
+		if ctx.Err() != nil {
+			return
+		}
+		// Left uncommitted it would hold the offset back for good, the
+		// user was told it failed
+		if router.Transient(err) {
+			logging.From(c.Ctx).Error("Update failed on every attempt, skipping it", "attempts", UpdateAttempts, logging.Err(err))
 		}
-		app.handleError(app.handleUpdate(upd), upd)
+		app.commitUpdate(ctx, upd.UpdateId)
+	})
+	app.logger.Info("Workers created", "count", app.numWorkers)
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		app.RunReminders(stop, ctx)
+	})
+	app.GetUpdates(stop, d)
+	d.Close()
+	wg.Wait()
+	// Telegram only forgets updates once asked for the next ones
+	app.bot.SetLastUpdate(app.offsets.Offset())
+	if err := app.bot.ConfirmUpdates(ctx); err != nil {
+		app.logger.Warn("Failed to confirm handled updates", logging.Err(errors.Join(common.ErrGetUpdates, err)))
 	}
 }
 
-func (app *MainApp) GetUpdates() {
-	for range app.numWorkers {
-		app.logger.Log(LogInfo, "Worker created")
-		go app.NewWorker()
-	}
-	for {
-		upds, err := app.bot.GetUpdates()
+// registerMetrics exposes the app's state read at scrape time
+func (app *MainApp) registerMetrics(reg *metrics.Registry) {
+	reg.GaugeFunc("schedule_cache_hit_ratio", "Share of schedule lookups served from the cache.", func() float64 {
+		hits, misses := scheduleCache.Value("hit"), scheduleCache.Value("miss")
+		if hits + misses == 0 {
+			return math.NaN()
+		}
+		return hits / (hits + misses)
+	})
+	reg.GaugeFunc("schedule_cached_groups", "Groups whose schedule is cached.", func() float64 {
+		app.schedulesMu.RLock()
+		defer app.schedulesMu.RUnlock()
+		return float64(len(app.groupsSchedules))
+	})
+	reg.GaugeFunc("bot_active_users", "Users who haven't blocked the bot.", func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), MetricsDbTimeout)
+		defer cancel()
+		n, err := app.db.CountActiveUsers(ctx)
 		if err != nil {
-			app.handleError(errors.Join(common.ErrGetUpdates, err), tg.Update{})
-			continue
+			app.logger.Warn("Failed to count active users", logging.Err(err))
+			return math.NaN()
 		}
-		for _, upd := range upds {
-			app.bot.SetLastUpdate(upd.UpdateId + 1)
-			app.updChan <- upd
+		return float64(n)
+	})
+	reg.GaugeFunc("bot_send_queue_depth", "Outgoing messages waiting for their turn.", func() float64 {
+		return float64(app.bot.Queue().Len())
+	})
+}
+
+func (app *MainApp) checkPolling(ctx context.Context) (string, error) {
+	age := time.Since(time.Unix(0, app.lastPoll.Load())).Round(time.Second)
+	detail := fmt.Sprintf("last successful getUpdates %s ago", age)
+	if age > MaxPollAge {
+		return detail, fmt.Errorf("no successful getUpdates for over %s", MaxPollAge)
+	}
+	return detail, nil
+}
+
+func (app *MainApp) checkDb(ctx context.Context) (string, error) {
+	return "", app.db.Ping(ctx)
+}
+
+func (app *MainApp) checkUpstream(ctx context.Context) (string, error) {
+	at, err := api.Reachable(ctx, UpstreamProbeAge)
+	return fmt.Sprintf("checked %s ago", time.Since(at).Round(time.Second)), err
+}
+
+func (app *MainApp) checkCache(ctx context.Context) (string, error) {
+	app.schedulesMu.RLock()
+	defer app.schedulesMu.RUnlock()
+	var oldest time.Time
+	for _, s := range(app.groupsSchedules) {
+		if oldest.IsZero() || s.fetched.Before(oldest) {
+			oldest = s.fetched
 		}
 	}
+	if oldest.IsZero() {
+		return "empty", nil
+	}
+	age := time.Since(oldest).Round(time.Second)
+	detail := fmt.Sprintf("%d groups, oldest fetched %s ago", len(app.groupsSchedules), age)
+	if age > MaxCacheAge {
+		return detail, fmt.Errorf("schedules older than %s", MaxCacheAge)
+	}
+	return detail, nil
+}
+
+// serveHttp runs the metrics and health server until it is shut down.
+// /healthz fails only when the bot is wedged and needs a restart, /readyz
+// also when it can't serve users. The schedule API being down isn't one
+// of those: cached schedules are still served, and restarting the bot
+// wouldn't bring the API back.
+func (app *MainApp) serveHttp(addr string) *http.Server {
+	polling := health.Check{ Name: "polling", Critical: true, Run: app.checkPolling }
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Default)
+	mux.Handle("GET /healthz", health.Handler(HealthTimeout, polling))
+	mux.Handle("GET /readyz", health.Handler(HealthTimeout,
+		polling,
+		health.Check{ Name: "db", Critical: true, Run: app.checkDb },
+		health.Check{ Name: "upstream", Run: app.checkUpstream },
+		health.Check{ Name: "cache", Run: app.checkCache },
+	))
+	srv := &http.Server{ Addr: addr, Handler: mux }
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			app.logger.Error("HTTP server failed", logging.Err(err))
+		}
+	}()
+	return srv
 }
 
 // TODO:
 // - timer to reset schedule cache daily?
 func main() {
-	logfile, err := os.OpenFile("ivgpu-schedule.log", os.O_CREATE | os.O_WRONLY, 0644)
+	godotenv.Load()
+
+	logConfig, err := logging.ConfigFromEnv()
 	if err != nil {
-		log.Fatal("Cannot open log file:", err)
+		log.Fatal("Bad logging settings: ", err)
 	}
-	logger := NewFileLogger(logfile)
-	godotenv.Load()
+	logger, logCloser, err := logging.New(logConfig)
+	if err != nil {
+		log.Fatal("Cannot set up logging: ", err)
+	}
+	defer logCloser.Close()
+	slog.SetDefault(logger)
 
 	token := os.Getenv("TOKEN")
 	if token == "" {
-		logger.Fatal("Provide token through env")
+		fatal(logger, "Provide token through env", nil)
 	}
 
 	numWorkers, err := strconv.Atoi(os.Getenv("NUM_WORKERS"))
 	if err != nil {
-		logger.Log(LogWarn, "Using default workers of count: 1")
+		logger.Warn("Using default workers count", "count", 1)
 		numWorkers = 1
 	}
 
@@ -523,13 +1191,78 @@ func main() {
 	if whitelistEnv := os.Getenv("WHITELIST"); whitelistEnv != "" {
 		whitelist = strings.Split(whitelistEnv, ",")
 	} else {
-		logger.Log(LogWarn, "Using empty whitelist")
+		logger.Warn("Using empty whitelist")
+	}
+
+	timezone := os.Getenv("TIMEZONE")
+	if timezone == "" {
+		timezone = common.DefaultTimezone
+	}
+	if err = common.SetLocation(timezone); err != nil {
+		fatal(logger, "Cannot set timezone", err)
 	}
 
-	mainApp, err := initMainApp(token, numWorkers, whitelist, logger)
+	if templatesDir := os.Getenv("TEMPLATES_DIR"); templatesDir != "" {
+		if err = api.LoadTemplates(templatesDir); err != nil {
+			fatal(logger, "Cannot load templates", err)
+		}
+	}
+
+	var admins []string
+	if adminsEnv := os.Getenv("ADMINS"); adminsEnv != "" {
+		admins = strings.Split(adminsEnv, ",")
+	}
+
+	if calendarFile := os.Getenv("CALENDAR_FILE"); calendarFile != "" {
+		if err = calendar.Default.Load(calendarFile); err != nil {
+			fatal(logger, "Cannot load calendar", err)
+		}
+	}
+
+	shutdownTimeout := DefaultShutdownTimeout
+	if timeoutEnv := os.Getenv("SHUTDOWN_TIMEOUT"); timeoutEnv != "" {
+		if shutdownTimeout, err = time.ParseDuration(timeoutEnv); err != nil {
+			fatal(logger, "Cannot parse shutdown timeout", err)
+		}
+	}
+
+	stop, cancelStop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancelStop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpAddr := os.Getenv("HTTP_ADDR")
+	if httpAddr == "" {
+		httpAddr = DefaultHttpAddr
+	}
+
+	mainApp, err := initMainApp(stop, token, numWorkers, whitelist, admins, logger)
 	if err != nil {
-		logger.Fatal(errors.Join(common.ErrInit, err))
+		fatal(logger, "Cannot start", errors.Join(common.ErrInit, err))
+	}
+	mainApp.registerMetrics(metrics.Default)
+	srv := mainApp.serveHttp(httpAddr)
+	logger.Info("Serving metrics and health checks", "addr", httpAddr)
+	logger.Info("App running")
+	done := make(chan struct{})
+	go func() {
+		mainApp.Run(stop, ctx)
+		close(done)
+	}()
+	<-stop.Done()
+	logger.Info("Shutting down")
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		logger.Warn("Shutdown timed out, aborting updates in flight", "timeout", shutdownTimeout)
+		cancel()
+		<-done
+	}
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), time.Second)
+	defer cancelShutdown()
+	srv.Shutdown(shutdownCtx)
+	if err = mainApp.db.Close(); err != nil {
+		logger.Error("Failed to close database", logging.Err(err))
 	}
-	logger.Log(LogInfo, "App running")
-	mainApp.GetUpdates()
+	logger.Info("App stopped")
 }
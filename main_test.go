@@ -0,0 +1,278 @@
+package main
+
+import (
+	"io"
+	"time"
+	"context"
+	"strings"
+	"testing"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+	"github.com/sergeykochiev/ivgpu-schedule/tg/tgfake"
+	"github.com/sergeykochiev/ivgpu-schedule/api"
+	"github.com/sergeykochiev/ivgpu-schedule/db/dbfake"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+	"github.com/sergeykochiev/ivgpu-schedule/i18n"
+)
+
+func TestMain(m *testing.M) {
+	// The server runs in UTC, three hours behind the university
+	time.Local = time.UTC
+	common.SetLocation(common.DefaultTimezone)
+	m.Run()
+}
+
+func TestWeekdayDate(t *testing.T) {
+	tests := []struct {
+		name string
+		utc time.Time
+		weekday int
+		want string
+	}{
+		// 23:59 on Saturday in Moscow, the current week
+		{ "saturday 23:59, monday", time.Date(2025, 9, 13, 20, 59, 0, 0, time.UTC), 1, "2025-09-08" },
+		{ "saturday 23:59, saturday", time.Date(2025, 9, 13, 20, 59, 0, 0, time.UTC), 6, "2025-09-13" },
+		// 00:01 on Sunday in Moscow, still Saturday in UTC: the week ahead
+		{ "sunday 00:01, monday", time.Date(2025, 9, 13, 21, 1, 0, 0, time.UTC), 1, "2025-09-15" },
+		{ "sunday 00:01, saturday", time.Date(2025, 9, 13, 21, 1, 0, 0, time.UTC), 6, "2025-09-20" },
+		// 23:59 on Sunday in Moscow
+		{ "sunday 23:59, monday", time.Date(2025, 9, 14, 20, 59, 0, 0, time.UTC), 1, "2025-09-15" },
+		// 00:01 on Monday in Moscow, still Sunday in UTC
+		{ "monday 00:01, monday", time.Date(2025, 9, 14, 21, 1, 0, 0, time.UTC), 1, "2025-09-15" },
+		{ "monday 00:01, friday", time.Date(2025, 9, 14, 21, 1, 0, 0, time.UTC), 5, "2025-09-19" },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			now := common.FixedClock{ T: tt.utc }.Now()
+			if got := weekdayDate(now, tt.weekday).Format("2006-01-02"); got != tt.want {
+				t.Errorf("weekdayDate = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+const replyTimeout = 5 * time.Second
+
+// upstream serves one institute with one group, having a lesson on Monday
+// of the first week, and a consultation and an exam in January
+func upstream() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /grouplist", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[{"abr": "ИИТ", "title": "Институт информационных технологий", "groups": [{"id": 42, "title": "1ИТ1"}]}]`)
+	})
+	mux.HandleFunc("GET /rasp/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("group_id") != "42" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, `{
+			"lesson_times": {"0": "8:00-9:30", "1": "9:40-11:10"},
+			"lesson_short_times": {"0": "8:00-9:00", "1": "9:10-10:10"},
+			"rasp": [{
+				"eduForm": "och",
+				"startDate": "2025-09-01",
+				"endDate": "2025-12-31",
+				"week_start": 1,
+				"lessons_on_period": [
+					{"lesson_title": "Программирование", "week_day": 0, "lesson_time": 0, "week": 1, "room": ["Б-101"]},
+					{"lesson_title": "Физкультура", "week_day": 0, "lesson_time": 1, "week": 2}
+				]
+			}, {
+				"eduForm": "exam_och",
+				"startDate": "2026-01-09",
+				"endDate": "2026-01-31",
+				"lessons_on_period": [
+					{"lesson_title": "Программирование", "form": "Консультация", "lesson_time": 1, "dates": ["2026-01-12"]},
+					{"lesson_title": "Программирование", "form": "Экзамен", "lesson_time": 1, "dates": ["2026-01-13"]}
+				]
+			}]
+		}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+func expect(t *testing.T, fake *tgfake.Server, chatId int, method string, contains string) tgfake.Reply {
+	t.Helper()
+	r, err := fake.ExpectReply(chatId, contains, replyTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Method != method {
+		t.Fatalf("got %s %q, want %s", r.Method, r.Text, method)
+	}
+	return r
+}
+
+// startApp runs the app against fake Telegram and schedule API until the
+// test ends, on Monday of the third week of autumn, a first one
+func startApp(t *testing.T, store *dbfake.Store) (*tgfake.Server, *MainApp) {
+	schedule := upstream()
+	t.Cleanup(schedule.Close)
+	base := api.Base
+	t.Cleanup(func() { api.Base = base })
+	api.Base = schedule.URL
+
+	fake := tgfake.New("test")
+	telegram := httptest.NewServer(fake)
+	t.Cleanup(telegram.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	app := newMainApp(tg.InitTgBotWithBase("test", tgfake.ApiBase(telegram.URL)), store, 2, nil, nil, logger)
+	app.clock = common.FixedClock{ T: time.Date(2025, 9, 15, 9, 0, 0, 0, time.UTC) }
+	if err := app.load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	stop, cancelStop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		app.Run(stop, context.Background())
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancelStop()
+		<-done
+	})
+	return fake, app
+}
+
+// A new user picks their group and asks for today's lessons, the way it
+// goes in Telegram
+func TestStartToToday(t *testing.T) {
+	fake, _ := startApp(t, dbfake.New())
+
+	const chatId = 1001
+	fake.SendText(chatId, "/start")
+	choice := expect(t, fake, chatId, tgfake.MethodSendMessage, i18n.T(i18n.RU, i18n.ChooseInstitute))
+
+	if _, err := fake.PressButtonByText(chatId, choice.MessageId, "ИИТ"); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, fake, chatId, tgfake.MethodEditMessage, i18n.T(i18n.RU, i18n.ChooseGroup))
+	expect(t, fake, chatId, tgfake.MethodAnswerCallbackQuery, "")
+
+	if _, err := fake.PressButtonByText(chatId, choice.MessageId, "1ИТ1"); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, fake, chatId, tgfake.MethodEditMessage, i18n.T(i18n.RU, i18n.GroupChanged))
+	keyboard := expect(t, fake, chatId, tgfake.MethodSendMessage, "1ИТ1")
+	if len(keyboard.ReplyMarkup) == 0 {
+		t.Error("the group is sent without the keyboard")
+	}
+	expect(t, fake, chatId, tgfake.MethodAnswerCallbackQuery, i18n.T(i18n.RU, i18n.ToastGroupChanged))
+
+	fake.SendText(chatId, i18n.T(i18n.RU, i18n.ButtonToday))
+	today := expect(t, fake, chatId, tgfake.MethodSendMessage, "Программирование")
+	for _, want := range([]string{ "15.9", "Понедельник", "8:00", "Б-101" }) {
+		if !strings.Contains(today.Text, want) {
+			t.Errorf("today misses %q:\n%s", want, today.Text)
+		}
+	}
+	if strings.Contains(today.Text, "Физкультура") {
+		t.Errorf("today lists the second week:\n%s", today.Text)
+	}
+}
+
+// Buttons switch a reminder to the state they show, tapping one again or
+// the update being handled twice doesn't switch it back
+func TestRemindersToggle(t *testing.T) {
+	store := dbfake.New()
+	fake, _ := startApp(t, store)
+	const chatId = 1002
+	if err := store.CreateUser(context.Background(), chatId, string(i18n.RU)); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.SendText(chatId, "/reminders")
+	menu := expect(t, fake, chatId, tgfake.MethodSendMessage, i18n.T(i18n.RU, i18n.Reminders))
+	evening := menu.InlineButtons()[0]
+	if !strings.Contains(evening.Text, "✅") {
+		t.Fatalf("evening reminders are off for a new user: %q", evening.Text)
+	}
+	for range(2) {
+		if _, err := fake.PressButton(chatId, menu.MessageId, evening.CallbackData); err != nil {
+			t.Fatal(err)
+		}
+		for {
+			r, err := fake.NextReply(chatId, replyTimeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Method == tgfake.MethodAnswerCallbackQuery {
+				break
+			}
+		}
+		user, err := store.GetUserById(context.Background(), chatId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.RemindEvening || !user.RemindMorning {
+			t.Errorf("evening %t, morning %t after a tap on evening, want false, true", user.RemindEvening, user.RemindMorning)
+		}
+	}
+	m, _ := fake.Message(chatId, menu.MessageId)
+	if got := m.InlineButtons()[0].Text; !strings.Contains(got, "❌") {
+		t.Errorf("evening button = %q, want it off", got)
+	}
+}
+
+// Every reminder goes out once, and is forgotten once its event is past
+func TestRemindersSentOnce(t *testing.T) {
+	store := dbfake.New()
+	fake, app := startApp(t, store)
+	ctx := context.Background()
+	const chatId = 1003
+	if err := store.CreateUser(ctx, chatId, string(i18n.RU)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetUserGroup(ctx, chatId, 42, "1ИТ1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 19:30 in Moscow on the eves of the consultation and the exam
+	for _, tt := range([]struct {
+		t time.Time
+		heading i18n.Key
+	}{
+		{ time.Date(2026, 1, 11, 16, 30, 0, 0, time.UTC), i18n.ReminderConsultationEvening },
+		{ time.Date(2026, 1, 12, 16, 30, 0, 0, time.UTC), i18n.ReminderExamEvening },
+	}) {
+		for range(2) {
+			if err := app.sendReminders(ctx, tt.t); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r := expect(t, fake, chatId, tgfake.MethodSendMessage, "Программирование")
+		if want := i18n.T(i18n.RU, tt.heading); !strings.Contains(r.Text, want) {
+			t.Errorf("reminder misses %q:\n%s", want, r.Text)
+		}
+	}
+	if r, err := fake.NextReply(chatId, 100 * time.Millisecond); err == nil {
+		t.Errorf("reminder sent twice: %q", r.Text)
+	}
+	if n := store.SentReminders(); n != 2 {
+		t.Errorf("%d reminders recorded, want 2", n)
+	}
+
+	if err := app.sendReminders(ctx, time.Date(2026, 1, 13, 21, 30, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if n := store.SentReminders(); n != 0 {
+		t.Errorf("%d reminders recorded after the exam, want 0", n)
+	}
+}
+
+// A chat typing faster than the limit is told to slow down, once
+func TestRateLimitReply(t *testing.T) {
+	fake, _ := startApp(t, dbfake.New())
+	const chatId = 1004
+	// Text matching no button gets no reply of its own
+	for range(UpdateBurst + 3) {
+		fake.SendText(chatId, "hello")
+	}
+	expect(t, fake, chatId, tgfake.MethodSendMessage, i18n.T(i18n.RU, i18n.ErrorRateLimited))
+	if r, err := fake.NextReply(chatId, 500 * time.Millisecond); err == nil {
+		t.Errorf("unexpected %s %q", r.Method, r.Text)
+	}
+}
@@ -0,0 +1,245 @@
+package metrics
+
+import (
+	"io"
+	"fmt"
+	"math"
+	"sync"
+	"slices"
+	"strings"
+	"strconv"
+	"net/http"
+)
+
+// Buckets for latencies in seconds, from a cached reply to a slow upstream
+var DefBuckets = []float64{ 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10 }
+
+type family interface {
+	write(w io.Writer)
+}
+
+// Registry serves its metrics in the Prometheus text format
+type Registry struct {
+	mu sync.Mutex
+	families []family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is where every package registers its metrics
+var Default = NewRegistry()
+
+func (r *Registry) add(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+	for _, f := range(families) {
+		f.write(w)
+	}
+}
+
+// series is a set of label values of a family, values are joined into
+// the key of the family's map
+type series[T any] struct {
+	values []string
+	v T
+}
+
+type vec[T any] struct {
+	name string
+	help string
+	typ string
+	labels []string
+	mu sync.Mutex
+	series map[string]*series[T]
+	init func() T
+}
+
+func newVec[T any](name, help, typ string, labels []string, init func() T) *vec[T] {
+	return &vec[T]{
+		name: name,
+		help: help,
+		typ: typ,
+		labels: labels,
+		series: make(map[string]*series[T]),
+		init: init,
+	}
+}
+
+// with calls fn on the series of values under the lock
+func (v *vec[T]) with(values []string, fn func(*T)) {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &series[T]{ values: slices.Clone(values), v: v.init() }
+		v.series[key] = s
+	}
+	fn(&s.v)
+}
+
+// each calls fn on every series sorted by label values, for a stable
+// output
+func (v *vec[T]) each(w io.Writer, fn func(labels string, t *T)) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.typ)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.series))
+	for k := range(v.series) {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range(keys) {
+		s := v.series[k]
+		fn(labelPairs(v.labels, s.values), &s.v)
+	}
+}
+
+// Counter only goes up, optionally split by labels
+type Counter struct {
+	*vec[float64]
+}
+
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{ newVec(name, help, "counter", labels, func() float64 { return 0 }) }
+	r.add(c)
+	return c
+}
+
+// Inc adds one to the series of the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) Add(n float64, values ...string) {
+	c.with(values, func(v *float64) { *v += n })
+}
+
+// Value is the current count of the series of the label values
+func (c *Counter) Value(values ...string) (n float64) {
+	c.with(values, func(v *float64) { n = *v })
+	return
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.each(w, func(labels string, v *float64) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, braces(labels), formatFloat(*v))
+	})
+}
+
+type histogram struct {
+	counts []uint64
+	sum float64
+	count uint64
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	*vec[histogram]
+	buckets []float64
+}
+
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = slices.Sorted(slices.Values(buckets))
+	h := &Histogram{
+		vec: newVec(name, help, "histogram", labels, func() histogram {
+			return histogram{ counts: make([]uint64, len(buckets)) }
+		}),
+		buckets: buckets,
+	}
+	r.add(h)
+	return h
+}
+
+// Observe counts x into its bucket, NaN is above every bound and only
+// reaches +Inf
+func (h *Histogram) Observe(x float64, values ...string) {
+	h.with(values, func(v *histogram) {
+		if i, _ := slices.BinarySearch(h.buckets, x); i < len(h.buckets) && !math.IsNaN(x) {
+			v.counts[i]++
+		}
+		v.sum += x
+		v.count++
+	})
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.each(w, func(labels string, v *histogram) {
+		sep := ""
+		if labels != "" {
+			sep = ","
+		}
+		var cumulative uint64
+		for i, le := range(h.buckets) {
+			cumulative += v.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", h.name, labels, sep, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", h.name, labels, sep, v.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, braces(labels), formatFloat(v.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, braces(labels), v.count)
+	})
+}
+
+// GaugeFunc reads its value at scrape time, NaN when it is unknown
+type GaugeFunc struct {
+	name string
+	help string
+	fn func() float64
+}
+
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{ name: name, help: help, fn: fn }
+	r.add(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, escapeHelp(g.help), g.name, g.name, formatFloat(g.fn()))
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func labelPairs(names []string, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range(names) {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", name, labelEscaper.Replace(values[i]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"net/http/httptest"
+)
+
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	return rec.Body.String()
+}
+
+func TestCounterExposition(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("test_total", "Help with \\ and\na newline.", "kind")
+	c.Inc("message")
+	c.Add(2.5, "message")
+	c.Inc(`say "hi"` + "\n" + `C:\path`)
+	want := `# HELP test_total Help with \\ and\na newline.
+# TYPE test_total counter
+test_total{kind="message"} 3.5
+test_total{kind="say \"hi\"\nC:\\path"} 1
+`
+	if got := scrape(t, r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := c.Value("message"); got != 3.5 {
+		t.Errorf("Value = %g, want 3.5", got)
+	}
+}
+
+func TestCounterWithoutLabels(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("test_total", "Plain.").Inc()
+	want := "# HELP test_total Plain.\n# TYPE test_total counter\ntest_total 1\n"
+	if got := scrape(t, r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogramBucketsAreCumulative(t *testing.T) {
+	r := NewRegistry()
+	// Unsorted on purpose, the registry sorts them
+	h := r.Histogram("test_seconds", "Latency.", []float64{ 1, 0.1, 0.5 }, "handler")
+	// On a bound, between bounds, above every bound and NaN
+	for _, x := range([]float64{ 0.1, 0.05, 0.3, 1, 7, math.NaN() }) {
+		h.Observe(x, "today")
+	}
+	h.Observe(0.2, "week")
+	want := `# HELP test_seconds Latency.
+# TYPE test_seconds histogram
+test_seconds_bucket{handler="today",le="0.1"} 2
+test_seconds_bucket{handler="today",le="0.5"} 3
+test_seconds_bucket{handler="today",le="1"} 4
+test_seconds_bucket{handler="today",le="+Inf"} 6
+test_seconds_sum{handler="today"} NaN
+test_seconds_count{handler="today"} 6
+test_seconds_bucket{handler="week",le="0.1"} 0
+test_seconds_bucket{handler="week",le="0.5"} 1
+test_seconds_bucket{handler="week",le="1"} 1
+test_seconds_bucket{handler="week",le="+Inf"} 1
+test_seconds_sum{handler="week"} 0.2
+test_seconds_count{handler="week"} 1
+`
+	if got := scrape(t, r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGaugeFuncSpecialValues(t *testing.T) {
+	tests := []struct {
+		v float64
+		want string
+	}{
+		{ 42, "42" },
+		{ 0.25, "0.25" },
+		{ 1e21, "1e+21" },
+		{ math.NaN(), "NaN" },
+		{ math.Inf(1), "+Inf" },
+		{ math.Inf(-1), "-Inf" },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.want, func(t *testing.T) {
+			r := NewRegistry()
+			r.GaugeFunc("test_age_seconds", "Age.", func() float64 { return tt.v })
+			want := "# HELP test_age_seconds Age.\n# TYPE test_age_seconds gauge\ntest_age_seconds " + tt.want + "\n"
+			if got := scrape(t, r); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic on a missing label value")
+		}
+	}()
+	NewRegistry().Counter("test_total", "Labels.", "kind", "handler").Inc("message")
+}
@@ -0,0 +1,55 @@
+package router
+
+import (
+	"sync"
+	"context"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+)
+
+// Dispatcher spreads updates over a fixed set of workers, each chat always
+// going to the same one. Updates of a chat are handled one at a time and
+// in order, different chats run in parallel.
+type Dispatcher struct {
+	shards []chan tg.Update
+	wg sync.WaitGroup
+}
+
+// NewDispatcher starts workers running handle, each with a queue of size
+// updates
+func NewDispatcher(workers int, size int, handle func(tg.Update)) *Dispatcher {
+	d := &Dispatcher{ shards: make([]chan tg.Update, max(workers, 1)) }
+	for i := range(d.shards) {
+		shard := make(chan tg.Update, size)
+		d.shards[i] = shard
+		d.wg.Go(func() {
+			for upd := range(shard) {
+				handle(upd)
+			}
+		})
+	}
+	return d
+}
+
+func (d *Dispatcher) shard(chatId int) chan tg.Update {
+	n := len(d.shards)
+	return d.shards[(chatId % n + n) % n]
+}
+
+// Dispatch queues upd on the worker of its chat, waiting while the queue
+// is full unless ctx is done first.
+func (d *Dispatcher) Dispatch(ctx context.Context, upd tg.Update) error {
+	select {
+	case d.shard(upd.ChatId()) <- upd:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops taking updates and waits for the queued ones to be handled
+func (d *Dispatcher) Close() {
+	for _, shard := range(d.shards) {
+		close(shard)
+	}
+	d.wg.Wait()
+}
@@ -0,0 +1,104 @@
+package router
+
+import (
+	"sync"
+	"time"
+	"context"
+	"testing"
+	"math/rand/v2"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+)
+
+func update(id int, chatId int) tg.Update {
+	return tg.Update{ UpdateId: id, Message: tg.ReceivedMessage{ Chat: tg.Chat{ Id: chatId } } }
+}
+
+func TestDispatcherKeepsChatOrder(t *testing.T) {
+	// Group chats have negative ids
+	chats := []int{ 1, 2, 3, -1, -2, -1001234567890, 1001234567890 }
+	const perChat = 50
+
+	var mu sync.Mutex
+	handled := make(map[int][]int)
+	busy := make(map[int]bool)
+	d := NewDispatcher(4, 2, func(upd tg.Update) {
+		chatId := upd.ChatId()
+		mu.Lock()
+		if busy[chatId] {
+			t.Errorf("chat %d handled concurrently", chatId)
+		}
+		busy[chatId] = true
+		mu.Unlock()
+		time.Sleep(time.Duration(rand.N(200)) * time.Microsecond)
+		mu.Lock()
+		busy[chatId] = false
+		handled[chatId] = append(handled[chatId], upd.UpdateId)
+		mu.Unlock()
+	})
+	// Interleaved the way getUpdates returns them
+	id := 0
+	for range(perChat) {
+		for _, chatId := range(chats) {
+			if err := d.Dispatch(context.Background(), update(id, chatId)); err != nil {
+				t.Fatal(err)
+			}
+			id++
+		}
+	}
+	d.Close()
+
+	for i, chatId := range(chats) {
+		got := handled[chatId]
+		if len(got) != perChat {
+			t.Errorf("chat %d: %d updates handled, want %d", chatId, len(got), perChat)
+			continue
+		}
+		for n, updId := range(got) {
+			if want := n * len(chats) + i; updId != want {
+				t.Errorf("chat %d: update %d handled at position %d, want %d", chatId, updId, n, want)
+				break
+			}
+		}
+	}
+}
+
+func TestDispatcherRunsChatsInParallel(t *testing.T) {
+	// With two workers 2 and -1 go to different ones. Each handler waits
+	// for the other chat, handling them one at a time would never finish.
+	chats := []int{ 2, -1 }
+	arrived := make(chan int, len(chats))
+	release := make(chan struct{})
+	d := NewDispatcher(2, 1, func(upd tg.Update) {
+		arrived <- upd.ChatId()
+		<-release
+	})
+	for i, chatId := range(chats) {
+		d.Dispatch(context.Background(), update(i, chatId))
+	}
+	timeout := time.After(time.Second)
+	for range(chats) {
+		select {
+		case <-arrived:
+		case <-timeout:
+			t.Fatal("chats weren't handled in parallel")
+		}
+	}
+	close(release)
+	d.Close()
+}
+
+func TestDispatchGivesUpWithContext(t *testing.T) {
+	release := make(chan struct{})
+	d := NewDispatcher(1, 0, func(upd tg.Update) {
+		<-release
+	})
+	defer d.Close()
+	defer close(release)
+	// The worker takes the first one and blocks, nothing takes the second
+	d.Dispatch(context.Background(), update(0, 1))
+	ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+	defer cancel()
+	if err := d.Dispatch(ctx, update(1, 1)); err == nil {
+		t.Error("Dispatch succeeded with every queue full")
+	}
+}
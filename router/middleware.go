@@ -0,0 +1,234 @@
+package router
+
+import (
+	"log/slog"
+	"context"
+	"fmt"
+	"time"
+	"errors"
+	"slices"
+	"strconv"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+	"github.com/sergeykochiev/ivgpu-schedule/db"
+	"github.com/sergeykochiev/ivgpu-schedule/i18n"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+	"github.com/sergeykochiev/ivgpu-schedule/logging"
+	"github.com/sergeykochiev/ivgpu-schedule/metrics"
+)
+
+// RecoverErr turns a panic into an error carrying the stack trace, to be
+// deferred on every long-lived goroutine so that one bad update or
+// schedule doesn't bring the whole bot down.
+func RecoverErr(err *error) {
+	if r := recover(); r != nil {
+		*err = errors.Join(*err, common.ErrPanic, fmt.Errorf("%v\n%s", r, debug.Stack()))
+	}
+}
+
+// Recover keeps a panic further down the chain from killing the worker
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) (err error) {
+			defer RecoverErr(&err)
+			return next(c)
+		}
+	}
+}
+
+func Validate() Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			if err := c.Update.Validate(); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+// Whitelist silently drops updates from other chats, an empty whitelist
+// lets everyone through.
+func Whitelist(chats []string) Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			if len(chats) > 0 && !slices.Contains(chats, strconv.Itoa(c.ChatId())) {
+				return nil
+			}
+			return next(c)
+		}
+	}
+}
+
+type UserStore interface {
+	GetUserById(ctx context.Context, id int) (db.User, error)
+}
+
+// LoadUser fills in the user and their language, trying attempts times.
+// Unknown users get the language of their Telegram client and HasUser
+// unset, routes that need a user add RequireUser.
+func LoadUser(store UserStore, attempts int) Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			var user db.User
+			err := Retry(c.Ctx, attempts, func() (err error) {
+				user, err = store.GetUserById(c.Ctx, c.ChatId())
+				return
+			})
+			switch {
+			case err == nil:
+				c.User, c.HasUser = user, true
+			case !errors.Is(err, common.ErrNoUser):
+				return errors.Join(common.ErrGetUserById, err)
+			}
+			c.Lang = i18n.Detect(c.Update.From().LanguageCode)
+			if c.User.Lang != "" {
+				c.Lang = i18n.Parse(c.User.Lang)
+			}
+			return next(c)
+		}
+	}
+}
+
+func RequireUser() Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			if !c.HasUser {
+				return common.ErrNoUser
+			}
+			return next(c)
+		}
+	}
+}
+
+// How often a chat over the rate limit is told about it
+const rateLimitNotice = time.Minute
+
+// RateLimit drops updates of a chat sending more than rate per second on
+// average, bursts up to burst are fine. Dropped updates fail with
+// common.ErrRateLimited, notify runs for the first of them and then at
+// most once every rateLimitNotice, so that the reply doesn't feed the
+// flood. Callback queries must still be answered by a middleware placed
+// before this one.
+func RateLimit(rate float64, burst int, notify Handler) Middleware {
+	chats := tg.NewChatBuckets(rate, burst)
+	notices := tg.NewChatBuckets(1 / rateLimitNotice.Seconds(), 1)
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			now := time.Now()
+			if chats.Allow(c.ChatId(), now) {
+				return next(c)
+			}
+			if notices.Allow(c.ChatId(), now) {
+				return errors.Join(common.ErrRateLimited, notify(c))
+			}
+			return common.ErrRateLimited
+		}
+	}
+}
+
+// Transient is true for errors that may go away on their own: the network
+// failing, Telegram or the schedule API asking to slow down or failing on
+// their side, the DB connection. Anything else fails the same way however
+// many times it is tried.
+func Transient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var tgErr *tg.Error
+	if errors.As(err, &tgErr) {
+		return tgErr.Code == http.StatusTooManyRequests || tgErr.Code >= 500
+	}
+	var statusErr *common.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code == http.StatusTooManyRequests || statusErr.Code >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || db.Transient(err)
+}
+
+// Retry runs fn again while it fails with a transient error, attempts
+// times in all, backing off in between. fn must be safe to repeat: a fetch
+// or a DB write setting a value, never a send.
+func Retry(ctx context.Context, attempts int, fn func() error) error {
+	backoff := tg.NewBackoff()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if attempt >= attempts || !Transient(err) {
+			return err
+		}
+		logging.From(ctx).Warn("Failed, trying again", "attempt", attempt, logging.Err(err))
+		select {
+		case <-time.After(backoff.Next()):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// Logging attaches a logger carrying the update's fields to c.Ctx, and
+// reports the outcome of every update: failures as errors, dropped ones
+// as warnings, the rest at debug level.
+func Logging(logger *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			l := logger.With("update_id", c.Update.UpdateId, "chat_id", c.ChatId(), "kind", c.Kind())
+			c.Ctx = logging.With(c.Ctx, l)
+			start := time.Now()
+			err := next(c)
+			l = l.With("handler", c.Handler, "duration", time.Since(start))
+			switch {
+			case err == nil:
+				l.Debug("Update handled")
+			case errors.Is(err, common.ErrRateLimited), errors.Is(err, common.ErrInvalidUpdate):
+				l.Warn("Update dropped", logging.Err(err))
+			default:
+				l.Error("Update failed", logging.Err(err))
+			}
+			return err
+		}
+	}
+}
+
+// Metrics counts updates by kind, and errors by the sentinels they carry,
+// and times handlers
+type Metrics struct {
+	Updates *metrics.Counter
+	Errors *metrics.Counter
+	Duration *metrics.Histogram
+}
+
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		Updates: reg.Counter("bot_updates_total", "Updates handled, by kind.", "kind"),
+		Errors: reg.Counter("bot_errors_total", "Errors returned by handlers, once for every sentinel an error carries.", "sentinel"),
+		Duration: reg.Histogram("bot_handler_duration_seconds", "Time spent handling an update, by route.", metrics.DefBuckets, "handler"),
+	}
+}
+
+func (m *Metrics) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			start := time.Now()
+			err := next(c)
+			handler := c.Handler
+			if handler == "" {
+				handler = "none"
+			}
+			m.Updates.Inc(c.Kind())
+			m.Duration.Observe(time.Since(start).Seconds(), handler)
+			if err != nil {
+				names := common.SentinelNames(err)
+				if len(names) == 0 {
+					names = []string{ "unknown" }
+				}
+				for _, name := range(slices.Compact(slices.Sorted(slices.Values(names)))) {
+					m.Errors.Inc(name)
+				}
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package router
+
+import (
+	"net"
+	"bytes"
+	"slices"
+	"strings"
+	"log/slog"
+	"errors"
+	"context"
+	"syscall"
+	"testing"
+	"net/url"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/lib/pq"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+	"github.com/sergeykochiev/ivgpu-schedule/metrics"
+)
+
+func TestRetry(t *testing.T) {
+	errDown := &net.OpError{ Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED }
+	tests := []struct {
+		name string
+		errs []error
+		calls int
+		err error
+	}{
+		{ "succeeds at once", []error{ nil }, 1, nil },
+		{ "transient then ok", []error{ errDown, nil }, 2, nil },
+		{ "transient every time", []error{ errDown, errDown, errDown, errDown }, 3, errDown },
+		{ "permanent", []error{ errors.Join(common.ErrGetSchedule, &tg.Error{ Code: 400 }) }, 1, common.ErrGetSchedule },
+		{ "transient then permanent", []error{ errDown, common.ErrTgBlocked }, 2, common.ErrTgBlocked },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Retry(context.Background(), 3, func() error {
+				calls++
+				return tt.errs[calls - 1]
+			})
+			if calls != tt.calls {
+				t.Errorf("%d calls, want %d", calls, tt.calls)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTransient(t *testing.T) {
+	refused := &net.OpError{ Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED }
+	tests := []struct {
+		name string
+		err error
+		want bool
+	}{
+		{ "nil", nil, false },
+		{ "cancelled", errors.Join(common.ErrGetToday, &url.Error{ Op: "Get", URL: "http://x", Err: context.Canceled }), false },
+		{ "plain error", errors.New("boom"), false },
+		{ "sentinel", common.ErrNoGroupId, false },
+		{ "rate limited", common.ErrRateLimited, false },
+		{ "connection refused", errors.Join(common.ErrGetToday, common.ErrGetSchedule, refused), true },
+		{ "http client timeout", &url.Error{ Op: "Get", URL: "http://x", Err: context.DeadlineExceeded }, true },
+		{ "tg 400", &tg.Error{ Code: 400, Description: "Bad Request: can't parse entities" }, false },
+		{ "tg not modified", errors.Join(common.ErrEditMsg, &tg.Error{ Code: 400, Description: "Bad Request: message is not modified" }), false },
+		{ "tg blocked", &tg.Error{ Code: 403, Description: "Forbidden: bot was blocked by the user" }, false },
+		{ "tg 429", &tg.Error{ Code: 429, Description: "Too Many Requests: retry after 5", RetryAfter: 5 }, true },
+		{ "tg 502", &tg.Error{ Code: 502, Description: "Bad Gateway" }, true },
+		{ "upstream 404", errors.Join(common.ErrNotOk, &common.StatusError{ Code: 404, Status: "404 Not Found" }), false },
+		{ "upstream 503", errors.Join(common.ErrNotOk, &common.StatusError{ Code: 503, Status: "503 Service Unavailable" }), true },
+		{ "db lost connection", driver.ErrBadConn, true },
+		{ "db connection closed", sql.ErrConnDone, true },
+		{ "db shutting down", &pq.Error{ Code: "57P01" }, true },
+		{ "db serialization", &pq.Error{ Code: "40001" }, true },
+		{ "db unique violation", &pq.Error{ Code: "23505" }, false },
+		{ "db no rows", errors.Join(common.ErrNoUser, sql.ErrNoRows), false },
+		{ "template", errors.Join(common.ErrRenderTemplate, errors.New("template: day:3: unexpected EOF")), false },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Transient(tt.err); got != tt.want {
+				t.Errorf("Transient(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitNotifiesOnce(t *testing.T) {
+	notified := 0
+	passed := 0
+	h := Chain(func(c *Context) error {
+		passed++
+		return nil
+	}, RateLimit(0.001, 2, func(c *Context) error {
+		notified++
+		c.Toast = "slow down"
+		return nil
+	}))
+	for i := range(5) {
+		c := &Context{ Ctx: context.Background(), Update: update(i, 1) }
+		err := h(c)
+		switch {
+		case i < 2 && err != nil:
+			t.Errorf("update %d: unexpected %v", i, err)
+		case i >= 2 && !errors.Is(err, common.ErrRateLimited):
+			t.Errorf("update %d: err = %v, want ErrRateLimited", i, err)
+		}
+		if want := i == 2; (c.Toast != "") != want {
+			t.Errorf("update %d: toast %q", i, c.Toast)
+		}
+	}
+	if passed != 2 || notified != 1 {
+		t.Errorf("%d passed, %d notified, want 2 and 1", passed, notified)
+	}
+	// Other chats have their own limit
+	if err := h(&Context{ Ctx: context.Background(), Update: update(5, 2) }); err != nil {
+		t.Errorf("other chat: unexpected %v", err)
+	}
+	notifyErr := errors.New("send failed")
+	h = RateLimit(0.001, 1, func(c *Context) error { return notifyErr })(func(c *Context) error { return nil })
+	h(&Context{ Ctx: context.Background(), Update: update(0, 1) })
+	if err := h(&Context{ Ctx: context.Background(), Update: update(1, 1) }); !errors.Is(err, common.ErrRateLimited) || !errors.Is(err, notifyErr) {
+		t.Errorf("err = %v, want ErrRateLimited along with the notice failure", err)
+	}
+}
+
+// A panic fails its update alone: it is logged and counted as ErrPanic and
+// the worker goes on with the next update of the chat
+func TestRecoverKeepsWorker(t *testing.T) {
+	var logs bytes.Buffer
+	m := NewMetrics(metrics.NewRegistry())
+	var handled []int
+	var errs []error
+	h := Chain(func(c *Context) error {
+		if c.Update.UpdateId == 1 {
+			panic("boom")
+		}
+		handled = append(handled, c.Update.UpdateId)
+		return nil
+	}, Logging(slog.New(slog.NewJSONHandler(&logs, nil))), m.Middleware(), Recover())
+	d := NewDispatcher(1, 4, func(upd tg.Update) {
+		errs = append(errs, h(&Context{ Ctx: context.Background(), Update: upd }))
+	})
+	for id := range(3) {
+		if err := d.Dispatch(context.Background(), update(id, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Close()
+
+	if !slices.Equal(handled, []int{ 0, 2 }) {
+		t.Errorf("handled %v, want [0 2]", handled)
+	}
+	if len(errs) != 3 || errs[0] != nil || !errors.Is(errs[1], common.ErrPanic) || errs[2] != nil {
+		t.Fatalf("errors %v, want ErrPanic for the second update only", errs)
+	}
+	if !strings.Contains(errs[1].Error(), "boom") || !strings.Contains(errs[1].Error(), "middleware_test.go") {
+		t.Errorf("the error misses the panic or its stack: %v", errs[1])
+	}
+	if n := m.Errors.Value("ErrPanic"); n != 1 {
+		t.Errorf("ErrPanic counted %v times, want 1", n)
+	}
+	if n := m.Updates.Value("message"); n != 3 {
+		t.Errorf("%v updates counted, want 3", n)
+	}
+	failed := 0
+	for _, line := range(strings.Split(strings.TrimSpace(logs.String()), "\n")) {
+		if strings.Contains(line, `"msg":"Update failed"`) {
+			failed++
+			if !strings.Contains(line, `"update_id":1,`) || !strings.Contains(line, "boom") {
+				t.Errorf("failure logged without the update or the panic: %s", line)
+			}
+		}
+	}
+	if failed != 1 {
+		t.Errorf("%d failures logged, want 1:\n%s", failed, logs.String())
+	}
+}
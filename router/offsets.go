@@ -0,0 +1,80 @@
+package router
+
+import (
+	"sync"
+)
+
+// Offsets follows updates from the moment they are fetched until they are
+// handled. The offset only moves past an update once it and every update
+// before it are handled, so that nothing is confirmed to Telegram before
+// it actually happened.
+type Offsets struct {
+	mu sync.Mutex
+	offset int
+	// Updates at or past offset, true once handled
+	pending map[int]bool
+	changed chan struct{}
+}
+
+func NewOffsets(offset int) *Offsets {
+	return &Offsets{
+		offset: offset,
+		pending: make(map[int]bool),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+func (o *Offsets) Offset() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.offset
+}
+
+// Track starts following id, it is false when id is already followed or
+// is before the offset, i.e. when Telegram delivers it again.
+func (o *Offsets) Track(id int) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.pending[id]; ok || id < o.offset {
+		return false
+	}
+	o.pending[id] = false
+	return true
+}
+
+// Done marks id handled, returning the offset and whether it moved
+func (o *Offsets) Done(id int) (int, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.pending[id]; !ok {
+		return o.offset, false
+	}
+	o.pending[id] = true
+	next, last := -1, o.offset - 1
+	for pid, done := range(o.pending) {
+		last = max(last, pid)
+		if !done && (next == -1 || pid < next) {
+			next = pid
+		}
+	}
+	if next == -1 {
+		next = last + 1
+	}
+	for pid := range(o.pending) {
+		if pid < next {
+			delete(o.pending, pid)
+		}
+	}
+	moved := next != o.offset
+	o.offset = next
+	select {
+	case o.changed <- struct{}{}:
+	default:
+	}
+	return next, moved
+}
+
+// Changed receives after Done was called
+func (o *Offsets) Changed() <-chan struct{} {
+	return o.changed
+}
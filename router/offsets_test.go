@@ -0,0 +1,90 @@
+package router
+
+import (
+	"testing"
+)
+
+func TestOffsetsOutOfOrder(t *testing.T) {
+	o := NewOffsets(100)
+	for _, id := range([]int{ 100, 101, 102, 103 }) {
+		if !o.Track(id) {
+			t.Fatalf("Track(%d) = false", id)
+		}
+	}
+	steps := []struct {
+		done int
+		offset int
+		moved bool
+	}{
+		// 100 is still in flight, nothing may be confirmed
+		{ 102, 100, false },
+		{ 101, 100, false },
+		{ 100, 103, true },
+		{ 103, 104, true },
+	}
+	for _, s := range(steps) {
+		offset, moved := o.Done(s.done)
+		if offset != s.offset || moved != s.moved {
+			t.Errorf("Done(%d) = %d, %t, want %d, %t", s.done, offset, moved, s.offset, s.moved)
+		}
+		if got := o.Offset(); got != s.offset {
+			t.Errorf("Offset after Done(%d) = %d, want %d", s.done, got, s.offset)
+		}
+	}
+}
+
+// Telegram skips ids it didn't deliver, e.g. updates of kinds the bot
+// doesn't ask for
+func TestOffsetsGaps(t *testing.T) {
+	o := NewOffsets(0)
+	o.Track(500)
+	o.Track(503)
+	if offset, _ := o.Done(503); offset != 500 {
+		t.Errorf("offset = %d with 500 in flight, want 500", offset)
+	}
+	if offset, _ := o.Done(500); offset != 504 {
+		t.Errorf("offset = %d, want 504", offset)
+	}
+}
+
+func TestOffsetsIgnoresRedelivered(t *testing.T) {
+	o := NewOffsets(10)
+	if o.Track(9) {
+		t.Error("Track took an update below the persisted offset")
+	}
+	if !o.Track(10) {
+		t.Fatal("Track(10) = false")
+	}
+	// Delivered again while in flight
+	if o.Track(10) {
+		t.Error("Track took an update in flight twice")
+	}
+	o.Done(10)
+	// Delivered again after it was handled
+	if o.Track(10) {
+		t.Error("Track took a handled update")
+	}
+	// Done for what isn't tracked changes nothing
+	if offset, moved := o.Done(7); offset != 11 || moved {
+		t.Errorf("Done(7) = %d, %t, want 11, false", offset, moved)
+	}
+	if offset, moved := o.Done(10); offset != 11 || moved {
+		t.Errorf("second Done(10) = %d, %t, want 11, false", offset, moved)
+	}
+}
+
+func TestOffsetsChanged(t *testing.T) {
+	o := NewOffsets(0)
+	o.Track(1)
+	select {
+	case <-o.Changed():
+		t.Fatal("Changed before anything was done")
+	default:
+	}
+	o.Done(1)
+	select {
+	case <-o.Changed():
+	default:
+		t.Error("Changed didn't receive after Done")
+	}
+}
@@ -0,0 +1,157 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"errors"
+	"strings"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+	"github.com/sergeykochiev/ivgpu-schedule/db"
+	"github.com/sergeykochiev/ivgpu-schedule/i18n"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+)
+
+// Context is what every handler gets: the update along with whatever the
+// middlewares before it have figured out.
+type Context struct {
+	// Cancelled when the bot is shutting down for good
+	Ctx context.Context
+	Update tg.Update
+	// Loaded by LoadUser, HasUser is false for users who never sent /start
+	User db.User
+	HasUser bool
+	Lang i18n.Lang
+	// Set for callback queries, MessageId falls back to the message the
+	// query came from
+	Query common.CallbackData
+	// Set for commands
+	Command string
+	Args []string
+	// Shown to the user when the callback query is answered
+	Toast string
+	// Route the update went to, for logs and metrics. Unknown commands
+	// and callbacks share one name so that users can't blow up metrics.
+	Handler string
+}
+
+func (c *Context) ChatId() int {
+	return c.Update.ChatId()
+}
+
+// Kind names the update for logs and metrics
+func (c *Context) Kind() string {
+	switch {
+	case c.Update.IsCallbackQuery():
+		return "callback"
+	case strings.HasPrefix(c.Update.Message.Text, "/"):
+		return "command"
+	}
+	return "message"
+}
+
+type Handler func(c *Context) error
+
+type Middleware func(next Handler) Handler
+
+// Chain wraps h so that the first middleware runs first
+func Chain(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+type buttonRoute struct {
+	key i18n.Key
+	stateful bool
+	handler Handler
+}
+
+// Router dispatches commands by name, callback queries by type and
+// keyboard buttons by their label in any language.
+type Router struct {
+	commands map[string]Handler
+	callbacks map[string]Handler
+	buttons []buttonRoute
+}
+
+func New() *Router {
+	return &Router{
+		commands: make(map[string]Handler),
+		callbacks: make(map[string]Handler),
+	}
+}
+
+func (r *Router) Command(name string, h Handler, mws ...Middleware) {
+	r.commands[name] = Chain(h, mws...)
+}
+
+func (r *Router) Callback(typ string, h Handler, mws ...Middleware) {
+	r.callbacks[typ] = Chain(h, mws...)
+}
+
+func (r *Router) Button(key i18n.Key, h Handler, mws ...Middleware) {
+	r.buttons = append(r.buttons, buttonRoute{ key: key, handler: Chain(h, mws...) })
+}
+
+// StatefulButton routes buttons made with i18n.Stateful
+func (r *Router) StatefulButton(key i18n.Key, h Handler, mws ...Middleware) {
+	r.buttons = append(r.buttons, buttonRoute{ key: key, stateful: true, handler: Chain(h, mws...) })
+}
+
+// ParseCommand splits "/name@bot arg1 arg2" into the name and its args
+func ParseCommand(text string) (name string, args []string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return
+	}
+	name, _, _ = strings.Cut(strings.TrimPrefix(fields[0], "/"), "@")
+	args = fields[1:]
+	return
+}
+
+func (r *Router) button(text string) (buttonRoute, bool) {
+	for _, route := range(r.buttons) {
+		match := i18n.Match
+		if route.stateful {
+			match = i18n.MatchStateful
+		}
+		if _, ok := match(text, route.key); ok {
+			return route, true
+		}
+	}
+	return buttonRoute{}, false
+}
+
+// Handle is the Handler at the end of the middleware chain
+func (r *Router) Handle(c *Context) error {
+	upd := c.Update
+	switch {
+	case upd.IsCallbackQuery():
+		c.Query = common.ParseCallbackData(upd.CallbackQuery.Data)
+		if c.Query.MessageId == 0 {
+			c.Query.MessageId = upd.CallbackQuery.Message.MessageId
+		}
+		h, ok := r.callbacks[c.Query.Typ]
+		if !ok {
+			c.Handler = "callback:unknown"
+			return errors.Join(common.ErrHandleQuery, fmt.Errorf("Unsupported callback query typ: %s", c.Query.Typ))
+		}
+		c.Handler = "callback:" + c.Query.Typ
+		return h(c)
+	case strings.HasPrefix(upd.Message.Text, "/"):
+		c.Command, c.Args = ParseCommand(upd.Message.Text)
+		h, ok := r.commands[c.Command]
+		if !ok {
+			c.Handler = "command:unknown"
+			return errors.Join(common.ErrCommand, fmt.Errorf("Unsupported command: %s", c.Command))
+		}
+		c.Handler = "command:" + c.Command
+		return h(c)
+	}
+	if route, ok := r.button(upd.Message.Text); ok {
+		c.Handler = "button:" + string(route.key)
+		return route.handler(c)
+	}
+	return nil
+}
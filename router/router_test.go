@@ -0,0 +1,145 @@
+package router
+
+import (
+	"slices"
+	"errors"
+	"context"
+	"testing"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+	"github.com/sergeykochiev/ivgpu-schedule/i18n"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		name string
+		args []string
+	}{
+		{ "/start", "start", []string{} },
+		{ "/start@botname", "start", []string{} },
+		{ "/start@botname arg", "start", []string{ "arg" } },
+		{ "  /shortday   2025-12-31 short ", "shortday", []string{ "2025-12-31", "short" } },
+		{ "/week\n2", "week", []string{ "2" } },
+		{ "/", "", []string{} },
+		{ "", "", nil },
+	}
+	for _, tt := range(tests) {
+		name, args := ParseCommand(tt.text)
+		if name != tt.name || !slices.Equal(args, tt.args) {
+			t.Errorf("ParseCommand(%q) = %q, %q, want %q, %q", tt.text, name, args, tt.name, tt.args)
+		}
+	}
+}
+
+func textUpdate(text string) tg.Update {
+	return tg.Update{ UpdateId: 1, Message: tg.ReceivedMessage{ MessageId: 5, Text: text, Chat: tg.Chat{ Id: 7 } } }
+}
+
+func callbackUpdate(data string) tg.Update {
+	return tg.Update{ UpdateId: 1, CallbackQuery: tg.CallbackQuery{
+		Id: "q",
+		Data: data,
+		Message: tg.ReceivedMessage{ MessageId: 5, Chat: tg.Chat{ Id: 7 } },
+		From: tg.User{ Id: 7 },
+	} }
+}
+
+func TestHandle(t *testing.T) {
+	var called []string
+	route := func(name string) Handler {
+		return func(c *Context) error {
+			called = append(called, name)
+			return nil
+		}
+	}
+	r := New()
+	r.Command("start", route("start"))
+	r.Button(i18n.ButtonToday, route("today"))
+	r.StatefulButton(i18n.ButtonChangeGroup, route("group"))
+	r.Callback("group", route("group callback"))
+
+	tests := []struct {
+		name string
+		upd tg.Update
+		called string
+		handler string
+		err error
+		check func(t *testing.T, c *Context)
+	}{
+		{ "command addressed to the bot", textUpdate("/start@botname arg"), "start", "command:start", nil, func(t *testing.T, c *Context) {
+			if c.Command != "start" || !slices.Equal(c.Args, []string{ "arg" }) {
+				t.Errorf("command %q, args %q", c.Command, c.Args)
+			}
+		} },
+		{ "unknown command", textUpdate("/nope 1"), "", "command:unknown", common.ErrCommand, nil },
+		{ "russian button", textUpdate(i18n.T(i18n.RU, i18n.ButtonToday)), "today", "button:button.today", nil, nil },
+		{ "english button", textUpdate(i18n.T(i18n.EN, i18n.ButtonToday)), "today", "button:button.today", nil, nil },
+		{ "russian stateful button", textUpdate(i18n.Stateful(i18n.RU, i18n.ButtonChangeGroup, "1ИТ1")), "group", "button:button.change_group", nil, nil },
+		{ "english stateful button", textUpdate(i18n.Stateful(i18n.EN, i18n.ButtonChangeGroup, "1ИТ1")), "group", "button:button.change_group", nil, nil },
+		{ "plain text", textUpdate("hello"), "", "", nil, nil },
+		{ "callback", callbackUpdate(`{"t":"group","d":"42"}`), "group callback", "callback:group", nil, func(t *testing.T, c *Context) {
+			if c.Query.Data != "42" || c.Query.MessageId != 5 {
+				t.Errorf("query %+v, want data 42 from message 5", c.Query)
+			}
+		} },
+		{ "callback naming its message", callbackUpdate(`{"m":9,"t":"group","d":"42"}`), "group callback", "callback:group", nil, func(t *testing.T, c *Context) {
+			if c.Query.MessageId != 9 {
+				t.Errorf("query %+v, want message 9", c.Query)
+			}
+		} },
+		{ "unknown callback", callbackUpdate(`{"t":"nope"}`), "", "callback:unknown", common.ErrHandleQuery, nil },
+		{ "malformed callback", callbackUpdate("nope"), "", "callback:unknown", common.ErrHandleQuery, nil },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			called = nil
+			c := &Context{ Ctx: context.Background(), Update: tt.upd }
+			err := r.Handle(c)
+			switch {
+			case tt.err == nil && err != nil:
+				t.Errorf("unexpected %v", err)
+			case !errors.Is(err, tt.err):
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+			var want []string
+			if tt.called != "" {
+				want = []string{ tt.called }
+			}
+			if !slices.Equal(called, want) {
+				t.Errorf("called %q, want %q", called, tt.called)
+			}
+			if c.Handler != tt.handler {
+				t.Errorf("handler %q, want %q", c.Handler, tt.handler)
+			}
+			if tt.check != nil {
+				tt.check(t, c)
+			}
+		})
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(c *Context) error {
+				order = append(order, name + " in")
+				err := next(c)
+				order = append(order, name + " out")
+				return err
+			}
+		}
+	}
+	h := Chain(func(c *Context) error {
+		order = append(order, "handler")
+		return nil
+	}, mw("first"), mw("second"))
+	if err := h(&Context{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{ "first in", "second in", "handler", "second out", "first out" }
+	if !slices.Equal(order, want) {
+		t.Errorf("order %q, want %q", order, want)
+	}
+}
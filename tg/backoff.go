@@ -0,0 +1,40 @@
+package tg
+
+import (
+	"time"
+	"math/rand/v2"
+)
+
+const (
+	DefaultBackoffMin = 500 * time.Millisecond
+	DefaultBackoffMax = time.Minute
+)
+
+// Backoff yields exponentially growing delays with full jitter, capped at
+// Max. It is not safe for concurrent use.
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+	attempt int
+}
+
+func NewBackoff() Backoff {
+	return Backoff{
+		Min: DefaultBackoffMin,
+		Max: DefaultBackoffMax,
+	}
+}
+
+func (b *Backoff) Next() time.Duration {
+	d := b.Min << b.attempt
+	if d <= 0 || d > b.Max {
+		d = b.Max
+	} else {
+		b.attempt++
+	}
+	return d / 2 + rand.N(d / 2 + 1)
+}
+
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
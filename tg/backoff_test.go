@@ -0,0 +1,75 @@
+package tg
+
+import (
+	"net"
+	"time"
+	"errors"
+	"testing"
+	"net/url"
+	"net/http"
+)
+
+func TestBackoffGrowsUpToMax(t *testing.T) {
+	b := Backoff{ Min: time.Second, Max: 8 * time.Second }
+	// Full jitter keeps every delay within the upper half of its step
+	for i, step := range([]time.Duration{ 1, 2, 4, 8, 8, 8, 8 }) {
+		step *= time.Second
+		if d := b.Next(); d < step / 2 || d > step {
+			t.Errorf("delay %d = %s, want within [%s, %s]", i, d, step / 2, step)
+		}
+	}
+	b.Reset()
+	if d := b.Next(); d > time.Second {
+		t.Errorf("delay after Reset = %s, want at most 1s", d)
+	}
+}
+
+func TestBackoffDoesNotOverflow(t *testing.T) {
+	b := NewBackoff()
+	for range(100) {
+		if d := b.Next(); d <= 0 || d > DefaultBackoffMax {
+			t.Fatalf("delay = %s", d)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	refused := &url.Error{ Op: "Post", URL: "http://x", Err: &net.OpError{ Op: "dial", Net: "tcp", Err: errors.New("connection refused") } }
+	reset := &url.Error{ Op: "Post", URL: "http://x", Err: &net.OpError{ Op: "read", Net: "tcp", Err: errors.New("connection reset by peer") } }
+	status := func(code int) *http.Response {
+		return &http.Response{ StatusCode: code }
+	}
+	tests := []struct {
+		name string
+		endpoint string
+		err error
+		res *http.Response
+		retryAfter int
+		retry bool
+		wait time.Duration
+	}{
+		{ "send refused", endpointSendMessage, refused, nil, 0, true, 0 },
+		{ "send reset after sending", endpointSendMessage, reset, nil, 0, false, 0 },
+		{ "send 502", endpointSendMessage, nil, status(502), 0, false, 0 },
+		{ "send 429", endpointSendMessage, nil, status(429), 3, true, 3 * time.Second },
+		{ "send 400", endpointSendMessage, nil, status(400), 0, false, 0 },
+		{ "edit reset", endpointEditMessage, reset, nil, 0, true, 0 },
+		{ "edit 502", endpointEditMessage, nil, status(502), 0, true, 0 },
+		{ "edit 403", endpointEditMessage, nil, status(403), 0, false, 0 },
+		{ "getUpdates reset", endpointGetUpdates, reset, nil, 0, true, 0 },
+		{ "answer 500", endpointAnswerCallbackQuery, nil, status(500), 0, true, 0 },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Backoff{ Min: time.Millisecond, Max: time.Millisecond }
+			tgRes := Response[bool]{ Parameters: ResponseParameters{ RetryAfter: tt.retryAfter } }
+			wait, retry := retryDelay(tt.endpoint, tt.err, tt.res, tgRes, &b)
+			if retry != tt.retry {
+				t.Errorf("retry = %t, want %t", retry, tt.retry)
+			}
+			if tt.wait > 0 && wait != tt.wait {
+				t.Errorf("wait = %s, want %s", wait, tt.wait)
+			}
+		})
+	}
+}
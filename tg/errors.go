@@ -0,0 +1,60 @@
+package tg
+
+import (
+	"fmt"
+	"strings"
+	"net/http"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+)
+
+// Error is a failed Bot API call as described by Telegram. It matches the
+// common.ErrTg* sentinels with errors.Is, so callers don't have to look at
+// the description themselves.
+type Error struct {
+	Code int
+	Description string
+	RetryAfter int
+}
+
+func (e *Error) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("telegram: %d %s (retry after %ds)", e.Code, e.Description, e.RetryAfter)
+	}
+	return fmt.Sprintf("telegram: %d %s", e.Code, e.Description)
+}
+
+func (e *Error) has(fragment string) bool {
+	return strings.Contains(strings.ToLower(e.Description), fragment)
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case common.ErrNotOk:
+		return true
+	case common.ErrTgBlocked:
+		return e.Code == http.StatusForbidden && (
+			e.has("bot was blocked by the user") ||
+			e.has("user is deactivated") ||
+			e.has("bot was kicked"))
+	case common.ErrTgChatNotFound:
+		return e.has("chat not found")
+	case common.ErrTgNotModified:
+		return e.has("message is not modified")
+	case common.ErrTgMessageNotFound:
+		return e.has("message to edit not found") || e.has("message to delete not found")
+	case common.ErrTgTooManyRequests:
+		return e.Code == http.StatusTooManyRequests
+	}
+	return false
+}
+
+func responseError[T any](tgRes Response[T]) error {
+	if tgRes.ErrorCode == 0 {
+		return common.ErrNotOk
+	}
+	return &Error{
+		Code: tgRes.ErrorCode,
+		Description: tgRes.Description,
+		RetryAfter: tgRes.Parameters.RetryAfter,
+	}
+}
@@ -0,0 +1,65 @@
+package tg_test
+
+import (
+	"errors"
+	"testing"
+	"github.com/sergeykochiev/ivgpu-schedule/common"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+	"github.com/sergeykochiev/ivgpu-schedule/tg/tgfake"
+)
+
+// Descriptions as Telegram sends them, a change in wording must show up
+// here rather than as users nobody can tell blocked the bot
+func TestErrorSentinels(t *testing.T) {
+	sentinels := []error{
+		common.ErrTgBlocked,
+		common.ErrTgChatNotFound,
+		common.ErrTgNotModified,
+		common.ErrTgMessageNotFound,
+		common.ErrTgTooManyRequests,
+	}
+	tests := []struct {
+		name string
+		method string
+		failure tgfake.Failure
+		want error
+	}{
+		{ "blocked", tgfake.MethodSendMessage, tgfake.Failure{ Code: 403, Description: "Forbidden: bot was blocked by the user" }, common.ErrTgBlocked },
+		{ "deactivated", tgfake.MethodSendMessage, tgfake.Failure{ Code: 403, Description: "Forbidden: user is deactivated" }, common.ErrTgBlocked },
+		{ "kicked", tgfake.MethodSendMessage, tgfake.Failure{ Code: 403, Description: "Forbidden: bot was kicked from the group chat" }, common.ErrTgBlocked },
+		{ "chat not found", tgfake.MethodSendMessage, tgfake.Failure{ Code: 400, Description: "Bad Request: chat not found" }, common.ErrTgChatNotFound },
+		{ "not modified", tgfake.MethodEditMessage, tgfake.Failure{ Code: 400, Description: "Bad Request: message is not modified: specified new message content and reply markup are exactly the same as a current content and reply markup of the message" }, common.ErrTgNotModified },
+		{ "message to edit not found", tgfake.MethodEditMessage, tgfake.Failure{ Code: 400, Description: "Bad Request: message to edit not found" }, common.ErrTgMessageNotFound },
+		{ "too many requests", tgfake.MethodEditMessage, tgfake.Failure{ Code: 429, Description: "Too Many Requests: retry after 0" }, common.ErrTgTooManyRequests },
+		// Not a sentinel of its own, but not to be taken for one either
+		{ "can't parse", tgfake.MethodSendMessage, tgfake.Failure{ Code: 400, Description: "Bad Request: can't parse entities: Can't find end of the entity starting at byte offset 3" }, nil },
+		{ "forbidden otherwise", tgfake.MethodSendMessage, tgfake.Failure{ Code: 403, Description: "Forbidden: bot can't initiate conversation with a user" }, nil },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, fake := newBot(t)
+			// Every attempt fails the same, whatever is retried
+			for range(5) {
+				fake.Fail(tt.method, tt.failure)
+			}
+			var err error
+			if tt.method == tgfake.MethodSendMessage {
+				err = send(bot, "hi")
+			} else {
+				err = edit(bot, 1, "hi")
+			}
+			var tgErr *tg.Error
+			if !errors.As(err, &tgErr) || tgErr.Code != tt.failure.Code || tgErr.Description != tt.failure.Description {
+				t.Fatalf("err = %v, want the decoded error", err)
+			}
+			if !errors.Is(err, common.ErrNotOk) {
+				t.Error("not an ErrNotOk")
+			}
+			for _, s := range(sentinels) {
+				if got, want := errors.Is(err, s), s == tt.want; got != want {
+					t.Errorf("errors.Is(err, %v) = %t, want %t", s, got, want)
+				}
+			}
+		})
+	}
+}
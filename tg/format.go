@@ -0,0 +1,94 @@
+package tg
+
+import (
+	"strings"
+	"html"
+)
+
+const (
+	ParseModeHTML = "HTML"
+	ParseModeMarkdownV2 = "MarkdownV2"
+)
+
+// Formatter produces text markup for one of the Telegram parse modes. Every
+// method escapes its arguments, so user and upstream data can be passed
+// as is.
+type Formatter interface {
+	ParseMode() string
+	Escape(string) string
+	Bold(string) string
+	Italic(string) string
+	Code(string) string
+	Link(text string, url string) string
+}
+
+type HTMLFormatter struct{}
+
+type MarkdownV2Formatter struct{}
+
+var (
+	HTML Formatter = HTMLFormatter{}
+	MarkdownV2 Formatter = MarkdownV2Formatter{}
+)
+
+func (HTMLFormatter) ParseMode() string {
+	return ParseModeHTML
+}
+
+func (HTMLFormatter) Escape(s string) string {
+	return html.EscapeString(s)
+}
+
+func (f HTMLFormatter) Bold(s string) string {
+	return "<b>" + f.Escape(s) + "</b>"
+}
+
+func (f HTMLFormatter) Italic(s string) string {
+	return "<i>" + f.Escape(s) + "</i>"
+}
+
+func (f HTMLFormatter) Code(s string) string {
+	return "<code>" + f.Escape(s) + "</code>"
+}
+
+func (f HTMLFormatter) Link(text string, url string) string {
+	return "<a href=\"" + f.Escape(url) + "\">" + f.Escape(text) + "</a>"
+}
+
+var (
+	markdownV2Escaper = newBackslashEscaper("_*[]()~`>#+-=|{}.!\\")
+	markdownV2CodeEscaper = newBackslashEscaper("`\\")
+	markdownV2LinkEscaper = newBackslashEscaper(")\\")
+)
+
+func newBackslashEscaper(chars string) *strings.Replacer {
+	var pairs []string
+	for _, c := range(chars) {
+		pairs = append(pairs, string(c), "\\" + string(c))
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+func (MarkdownV2Formatter) ParseMode() string {
+	return ParseModeMarkdownV2
+}
+
+func (MarkdownV2Formatter) Escape(s string) string {
+	return markdownV2Escaper.Replace(s)
+}
+
+func (f MarkdownV2Formatter) Bold(s string) string {
+	return "*" + f.Escape(s) + "*"
+}
+
+func (f MarkdownV2Formatter) Italic(s string) string {
+	return "_" + f.Escape(s) + "_"
+}
+
+func (MarkdownV2Formatter) Code(s string) string {
+	return "`" + markdownV2CodeEscaper.Replace(s) + "`"
+}
+
+func (f MarkdownV2Formatter) Link(text string, url string) string {
+	return "[" + f.Escape(text) + "](" + markdownV2LinkEscaper.Replace(url) + ")"
+}
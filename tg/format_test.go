@@ -0,0 +1,59 @@
+package tg
+
+import (
+	"testing"
+)
+
+func TestHTMLFormatter(t *testing.T) {
+	f := HTML
+	tests := []struct {
+		name string
+		got string
+		want string
+	}{
+		{ "escape", f.Escape(`Теория <графов> & "сетей"`), `Теория &lt;графов&gt; &amp; &#34;сетей&#34;` },
+		{ "already escaped", f.Escape("&amp;"), "&amp;amp;" },
+		{ "bold lesson", f.Bold("C++ & <STL>"), "<b>C++ &amp; &lt;STL&gt;</b>" },
+		{ "italic", f.Italic("Лек<ция>"), "<i>Лек&lt;ция&gt;</i>" },
+		{ "code room", f.Code(`"А" & Б`), "<code>&#34;А&#34; &amp; Б</code>" },
+		{ "teacher with a quote", f.Escape(`O'Brien "Jr."`), "O&#39;Brien &#34;Jr.&#34;" },
+		{ "link", f.Link("Zoom <1>", `https://zoom.us/j/1?pwd="x"&a=<b>`), `<a href="https://zoom.us/j/1?pwd=&#34;x&#34;&amp;a=&lt;b&gt;">Zoom &lt;1&gt;</a>` },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownV2Formatter(t *testing.T) {
+	f := MarkdownV2
+	tests := []struct {
+		name string
+		got string
+		want string
+	}{
+		{ "every special character", f.Escape("_*[]()~`>#+-=|{}.!\\"), "\\_\\*\\[\\]\\(\\)\\~\\`\\>\\#\\+\\-\\=\\|\\{\\}\\.\\!\\\\" },
+		{ "plain text", f.Escape("Иванов И И"), "Иванов И И" },
+		{ "lesson", f.Bold("Физ-ра (1 п/г)."), "*Физ\\-ра \\(1 п/г\\)\\.*" },
+		{ "teacher", f.Italic("Smith_J. [доц.]"), "_Smith\\_J\\. \\[доц\\.\\]_" },
+		{ "code only escapes ` and \\", f.Code("a_b `c` \\d"), "`a_b \\`c\\` \\\\d`" },
+		{ "link", f.Link("Лекция 1.", "https://example.com/a_(b)?c=1.2"), "[Лекция 1\\.](https://example.com/a_(b\\)?c=1.2)" },
+		{ "link with a backslash", f.Link("x", `https://example.com/\)`), `[x](https://example.com/\\\))` },
+	}
+	for _, tt := range(tests) {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseModes(t *testing.T) {
+	if HTML.ParseMode() != ParseModeHTML || MarkdownV2.ParseMode() != ParseModeMarkdownV2 {
+		t.Error("formatters report the wrong parse mode")
+	}
+}
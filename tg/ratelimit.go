@@ -0,0 +1,210 @@
+package tg
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits from https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this
+const (
+	GlobalSendRate = 30
+	GlobalSendBurst = 30
+	ChatSendRate = 1
+	ChatSendBurst = 3
+)
+
+const (
+	defaultQueueWorkers = 8
+	defaultQueueSize = 256
+	// Idle per-chat buckets are dropped after this long, they are full by then anyway
+	chatBucketTtl = time.Minute
+)
+
+type bucket struct {
+	rate float64
+	burst float64
+	tokens float64
+	last time.Time
+}
+
+func newBucket(rate float64, burst int, now time.Time) bucket {
+	return bucket{
+		rate: rate,
+		burst: float64(burst),
+		tokens: float64(burst),
+		last: now,
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = min(b.burst, b.tokens + now.Sub(b.last).Seconds() * b.rate)
+	b.last = now
+}
+
+// reserve takes one token, possibly going into debt, and returns how long
+// the caller has to wait before the token is actually available.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// allow takes one token only if there is one
+func (b *bucket) allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// ChatBuckets keeps a token bucket for every chat, rate tokens a second up
+// to burst.
+type ChatBuckets struct {
+	mu sync.Mutex
+	rate float64
+	burst int
+	chats map[int]*bucket
+	lastSweep time.Time
+}
+
+func NewChatBuckets(rate float64, burst int) *ChatBuckets {
+	return &ChatBuckets{
+		rate: rate,
+		burst: burst,
+		chats: make(map[int]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// get must be called with mu held
+func (cb *ChatBuckets) get(chatId int, now time.Time) *bucket {
+	if now.Sub(cb.lastSweep) > chatBucketTtl {
+		for id, b := range(cb.chats) {
+			if now.Sub(b.last) > chatBucketTtl {
+				delete(cb.chats, id)
+			}
+		}
+		cb.lastSweep = now
+	}
+	b, ok := cb.chats[chatId]
+	if !ok {
+		nb := newBucket(cb.rate, cb.burst, now)
+		b = &nb
+		cb.chats[chatId] = b
+	}
+	return b
+}
+
+// Reserve takes a token of the chat, possibly going into debt, and returns
+// how long to wait for it
+func (cb *ChatBuckets) Reserve(chatId int, now time.Time) time.Duration {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.get(chatId, now).reserve(now)
+}
+
+// Allow takes a token of the chat, false when it has none left
+func (cb *ChatBuckets) Allow(chatId int, now time.Time) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.get(chatId, now).allow(now)
+}
+
+// Limiter enforces both the global and the per-chat send rate.
+type Limiter struct {
+	mu sync.Mutex
+	global bucket
+	chats *ChatBuckets
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{
+		global: newBucket(GlobalSendRate, GlobalSendBurst, time.Now()),
+		chats: NewChatBuckets(ChatSendRate, ChatSendBurst),
+	}
+}
+
+func (l *Limiter) reserve(chatId int) time.Duration {
+	now := time.Now()
+	l.mu.Lock()
+	global := l.global.reserve(now)
+	l.mu.Unlock()
+	return max(global, l.chats.Reserve(chatId, now))
+}
+
+// Wait blocks until chatId may be sent to, or ctx is done
+func (l *Limiter) Wait(ctx context.Context, chatId int) error {
+	d := l.reserve(chatId)
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type sendJob struct {
+	ctx context.Context
+	chatId int
+	fn func(ctx context.Context) error
+	done chan error
+}
+
+// SendQueue serializes outgoing calls through a shared Limiter, so that
+// replies and broadcasts together stay within Telegram limits.
+type SendQueue struct {
+	jobs chan sendJob
+	limiter *Limiter
+	depth atomic.Int64
+}
+
+func NewSendQueue(limiter *Limiter, workers int, size int) *SendQueue {
+	q := &SendQueue{
+		jobs: make(chan sendJob, size),
+		limiter: limiter,
+	}
+	for range workers {
+		go q.worker()
+	}
+	return q
+}
+
+func (q *SendQueue) worker() {
+	for job := range q.jobs {
+		err := q.limiter.Wait(job.ctx, job.chatId)
+		if err == nil {
+			err = job.fn(job.ctx)
+		}
+		q.depth.Add(-1)
+		job.done <- err
+	}
+}
+
+// Push enqueues fn to be run once chatId is allowed to receive a message.
+// The returned channel receives the result of fn, or the error of ctx if
+// it is done before fn gets to run.
+func (q *SendQueue) Push(ctx context.Context, chatId int, fn func(ctx context.Context) error) <-chan error {
+	done := make(chan error, 1)
+	q.depth.Add(1)
+	select {
+	case q.jobs <- sendJob{ ctx: ctx, chatId: chatId, fn: fn, done: done }:
+	case <-ctx.Done():
+		q.depth.Add(-1)
+		done <- ctx.Err()
+	}
+	return done
+}
+
+func (q *SendQueue) Len() int {
+	return int(q.depth.Load())
+}
@@ -0,0 +1,118 @@
+package tg
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+	"errors"
+	"slices"
+	"context"
+	"testing"
+)
+
+func TestChatBucketsAllow(t *testing.T) {
+	cb := NewChatBuckets(1, 3)
+	now := time.Now()
+	for i := range(3) {
+		if !cb.Allow(1, now) {
+			t.Fatalf("update %d of the burst dropped", i)
+		}
+	}
+	if cb.Allow(1, now) {
+		t.Error("update past the burst allowed")
+	}
+	if !cb.Allow(-1, now) {
+		t.Error("another chat limited by the first one")
+	}
+	if !cb.Allow(1, now.Add(time.Second)) {
+		t.Error("token not refilled after a second")
+	}
+	if cb.Allow(1, now.Add(time.Second)) {
+		t.Error("more than a token refilled in a second")
+	}
+}
+
+func TestChatBucketsReserve(t *testing.T) {
+	cb := NewChatBuckets(2, 1)
+	now := time.Now()
+	if d := cb.Reserve(1, now); d != 0 {
+		t.Errorf("first reserve waits %s", d)
+	}
+	if d := cb.Reserve(1, now); d != 500 * time.Millisecond {
+		t.Errorf("second reserve waits %s, want 500ms", d)
+	}
+	if d := cb.Reserve(1, now); d != time.Second {
+		t.Errorf("third reserve waits %s, want 1s", d)
+	}
+}
+
+func TestChatBucketsSweep(t *testing.T) {
+	cb := NewChatBuckets(1, 1)
+	now := time.Now()
+	cb.Allow(1, now)
+	cb.Allow(2, now.Add(chatBucketTtl))
+	cb.Allow(3, now.Add(2 * chatBucketTtl + time.Second))
+	if _, ok := cb.chats[1]; ok {
+		t.Error("idle bucket kept")
+	}
+	if len(cb.chats) != 1 {
+		t.Errorf("%d buckets kept, want 1", len(cb.chats))
+	}
+}
+
+func TestSendQueueSpacesChatSends(t *testing.T) {
+	q := NewSendQueue(NewLimiter(), 4, 16)
+	var mu sync.Mutex
+	sent := make(map[int][]time.Time)
+	start := time.Now()
+	var results []<-chan error
+	push := func(chatId int) {
+		results = append(results, q.Push(context.Background(), chatId, func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			sent[chatId] = append(sent[chatId], time.Now())
+			return nil
+		}))
+	}
+	// One past the chat's burst, and another chat meanwhile
+	for range(ChatSendBurst + 1) {
+		push(1)
+	}
+	push(2)
+	for _, done := range(results) {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	last := slices.MaxFunc(sent[1], func(a, b time.Time) int { return a.Compare(b) })
+	if waited := last.Sub(start); waited < 900 * time.Millisecond {
+		t.Errorf("send past the burst went out after %s, want about 1s", waited)
+	}
+	if waited := sent[2][0].Sub(start); waited > 500 * time.Millisecond {
+		t.Errorf("another chat waited %s behind a busy one", waited)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Len = %d after every job finished", q.Len())
+	}
+}
+
+func TestSendQueueGivesUpWithContext(t *testing.T) {
+	q := NewSendQueue(NewLimiter(), 1, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	// Use up the chat's burst, the next one has to wait
+	for range(ChatSendBurst) {
+		<-q.Push(ctx, 1, func(ctx context.Context) error { return nil })
+	}
+	var ran atomic.Bool
+	done := q.Push(ctx, 1, func(ctx context.Context) error {
+		ran.Store(true)
+		return nil
+	})
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if ran.Load() {
+		t.Error("job ran after its context was cancelled")
+	}
+}
@@ -1,21 +1,30 @@
 package tg 
 
 import (
+	"context"
+	"time"
+	"errors"
+	"fmt"
 	"encoding/json"
+	"net"
 	"net/http"
 	"github.com/sergeykochiev/ivgpu-schedule/common"
 )
 
 const ApiBase = "https://api.telegram.org/bot"
 
+const maxAttempts = 5
+
 const (
 	endpointSendMessage = "sendMessage"
 	endpointEditMessage = "editMessageText"
 	endpointGetUpdates = "getUpdates"
+	endpointAnswerCallbackQuery = "answerCallbackQuery"
 )
 
 type User struct {
 	Id int `json:"id"`
+	LanguageCode string `json:"language_code"`
 }
 
 type CallbackQuery struct {
@@ -38,10 +47,34 @@ func (u Update) ChatId() int {
 	return u.Message.Chat.Id
 }
 
+func (u Update) From() User {
+	if u.IsCallbackQuery() {
+		return u.CallbackQuery.From
+	}
+	return u.Message.From
+}
+
 func (u Update) IsCallbackQuery() bool {
 	return u.CallbackQuery.Id != ""
 }
 
+// Validate rejects updates without anyone to answer to, and reports the
+// kinds the bot doesn't handle: anything but text messages and callback
+// queries.
+func (u Update) Validate() error {
+	switch {
+	case u.ChatId() == 0:
+		return errors.Join(common.ErrInvalidUpdate, fmt.Errorf("update %d has no chat", u.UpdateId))
+	case u.IsCallbackQuery():
+		return nil
+	case u.Message.MessageId == 0:
+		return errors.Join(common.ErrInvalidUpdate, fmt.Errorf("update %d has no message", u.UpdateId))
+	case u.Message.Text == "":
+		return errors.Join(common.ErrUnsupportedUpdate, fmt.Errorf("message %d has no text", u.Message.MessageId))
+	}
+	return nil
+}
+
 type Chat struct {
 	Id int `json:"id"`
 }
@@ -74,11 +107,13 @@ type ReceivedMessage struct {
 type BaseSentMessage struct {
 	ChatId int    `json:"chat_id"`
 	Text   string `json:"text"`
+	ParseMode string `json:"parse_mode,omitempty"`
 }
 
 type SentMessage[T any] struct {
 	ChatId int    `json:"chat_id"`
 	Text   string `json:"text"`
+	ParseMode string `json:"parse_mode,omitempty"`
 	ReplyMarkup T `json:"reply_markup"`
 }
 
@@ -86,49 +121,194 @@ type BaseEditedMessage struct {
 	ChatId int    `json:"chat_id"`
 	MessageId int `json:"message_id"`
 	Text   string `json:"text"`
+	ParseMode string `json:"parse_mode,omitempty"`
 }
 type EditedMessage struct {
 	ChatId int    `json:"chat_id"`
 	MessageId int `json:"message_id"`
 	Text   string `json:"text"`
+	ParseMode string `json:"parse_mode,omitempty"`
 	ReplyMarkup InlineKeyboardMarkup `json:"reply_markup"`
 }
 
+type ResponseParameters struct {
+	RetryAfter int `json:"retry_after"`
+}
+
+type AnsweredCallbackQuery struct {
+	CallbackQueryId string `json:"callback_query_id"`
+	Text string `json:"text,omitempty"`
+	ShowAlert bool `json:"show_alert,omitempty"`
+}
+
 type Response[T any] struct {
 	Ok     bool `json:"ok"`
 	Result T    `json:"result"`
+	ErrorCode int `json:"error_code"`
+	Description string `json:"description"`
+	Parameters ResponseParameters `json:"parameters"`
 }
 
 type Bot struct {
 	token          string
+	apiBase        string
 	lastUpdateId   int
 	allowedUpdates []string
+	queue          *SendQueue
+	backoff        Backoff
+}
+
+type ChatMessage interface {
+	Chat() int
+}
+
+func (m BaseSentMessage) Chat() int {
+	return m.ChatId
+}
+
+func (m SentMessage[T]) Chat() int {
+	return m.ChatId
+}
+
+func (m BaseEditedMessage) Chat() int {
+	return m.ChatId
+}
+
+func (m EditedMessage) Chat() int {
+	return m.ChatId
 }
 
 type UpdatesRequest struct {
 	Offset         int      `json:"offset"`
+	Limit          int      `json:"limit,omitempty"`
 	Timeout        int      `json:"timeout"`
 	AllowedUpdates []string `json:"allowed_updates"`
 }
 
 func InitTgBot(token string) Bot {
+	return InitTgBotWithBase(token, ApiBase)
+}
+
+func InitTgBotWithBase(token string, apiBase string) Bot {
 	return Bot{
 		token: token,
+		apiBase: apiBase,
 		allowedUpdates: []string{"message", "callback_query"},
+		queue: NewSendQueue(NewLimiter(), defaultQueueWorkers, defaultQueueSize),
+		backoff: NewBackoff(),
+	}
+}
+
+// SetBackoff changes the delays between attempts at a failing call
+func (t *Bot) SetBackoff(b Backoff) {
+	t.backoff = b
+}
+
+// idempotent calls can be made again whatever happened to the first one.
+// A message sent twice shows up twice, so sendMessage is only repeated
+// when it surely didn't reach Telegram or Telegram turned it down.
+func idempotent(endpoint string) bool {
+	switch (endpoint) {
+	case endpointEditMessage, endpointGetUpdates, endpointAnswerCallbackQuery:
+		return true
 	}
+	return false
 }
 
-func baseTgReq[T any](t *Bot, body T, endpoint string) (err error) {
-	_, err = common.JsonReq[Response[any]](t.url(endpoint), body)
-	return
+// notSent is true for errors a request failed with before a connection was
+// made, nothing reached the server then
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	return errors.As(err, &dnsErr) || errors.As(err, &opErr) && opErr.Op == "dial"
 }
 
-func SendMsg[T any](t *Bot, m T) error {
-	return baseTgReq(t, m, endpointSendMessage)
+// retryDelay decides whether a failed call is worth repeating: flood
+// control is waited out for as long as Telegram asks, network and server
+// errors are backed off, anything else is final. Network and server errors
+// may come after Telegram acted on the call, only idempotent calls are
+// repeated then.
+func retryDelay[T any](endpoint string, err error, res *http.Response, tgRes Response[T], backoff *Backoff) (time.Duration, bool) {
+	switch {
+	case res == nil && (idempotent(endpoint) || notSent(err)):
+		return backoff.Next(), true
+	case res == nil:
+		return 0, false
+	case res.StatusCode == http.StatusTooManyRequests:
+		if tgRes.Parameters.RetryAfter > 0 {
+			return time.Duration(tgRes.Parameters.RetryAfter) * time.Second, true
+		}
+		return backoff.Next(), true
+	case res.StatusCode >= 500 && idempotent(endpoint):
+		return backoff.Next(), true
+	}
+	return 0, false
+}
+
+func call[T any](ctx context.Context, t *Bot, endpoint string, body any) (result T, err error) {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+	backoff := t.backoff
+	backoff.Reset()
+	for attempt := 1; ; attempt++ {
+		var tgRes Response[T]
+		var res *http.Response
+		res, err = common.Req(ctx, http.MethodPost, t.url(endpoint), bodyBytes)
+		if res != nil {
+			decodeErr := json.NewDecoder(res.Body).Decode(&tgRes)
+			res.Body.Close()
+			switch {
+			case decodeErr == nil && !tgRes.Ok:
+				err = responseError(tgRes)
+			case err == nil && decodeErr != nil:
+				err = decodeErr
+			}
+		}
+		if err == nil {
+			result = tgRes.Result
+			return
+		}
+		wait, retry := retryDelay(endpoint, err, res, tgRes, &backoff)
+		if !retry || attempt == maxAttempts || ctx.Err() != nil {
+			return
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			err = errors.Join(err, ctx.Err())
+			return
+		}
+	}
 }
 
-func EditMsg[T any](t *Bot, m T) error {
-	return baseTgReq(t, m, endpointEditMessage)
+func baseTgReq[T ChatMessage](ctx context.Context, t *Bot, body T, endpoint string) error {
+	return <-t.queue.Push(ctx, body.Chat(), func(ctx context.Context) error {
+		_, err := call[json.RawMessage](ctx, t, endpoint, body)
+		return err
+	})
+}
+
+func SendMsg[T ChatMessage](ctx context.Context, t *Bot, m T) error {
+	return baseTgReq(ctx, t, m, endpointSendMessage)
+}
+
+func EditMsg[T ChatMessage](ctx context.Context, t *Bot, m T) error {
+	return baseTgReq(ctx, t, m, endpointEditMessage)
+}
+
+// AnswerCallbackQuery bypasses the send queue: answers don't count towards
+// message limits and the client keeps spinning until one arrives.
+func AnswerCallbackQuery(ctx context.Context, t *Bot, a AnsweredCallbackQuery) error {
+	_, err := call[bool](ctx, t, endpointAnswerCallbackQuery, a)
+	return err
+}
+
+// Queue is shared by every send made through the bot, broadcasts should go
+// through it too so that they don't starve regular replies of rate limit.
+func (t *Bot) Queue() *SendQueue {
+	return t.queue
 }
 
 func (t *Bot) SetLastUpdate(id int) {
@@ -136,28 +316,25 @@ func (t *Bot) SetLastUpdate(id int) {
 }
 
 func (t *Bot) url(endpoint string) string {
-	return ApiBase + t.token + "/" + endpoint
+	return t.apiBase + t.token + "/" + endpoint
 }
 
-func (t *Bot) GetUpdates() (output []Update, err error) {
-	var tgRes Response[[]Update]
-	bodyBytes, err := json.Marshal(UpdatesRequest{
+// ConfirmUpdates tells Telegram that every update before the last one set
+// is handled, without waiting for new ones. The update it may get back is
+// left unconfirmed and comes again on the next poll.
+func (t *Bot) ConfirmUpdates(ctx context.Context) error {
+	_, err := call[[]Update](ctx, t, endpointGetUpdates, UpdatesRequest{
+		Offset: t.lastUpdateId,
+		Limit: 1,
+		AllowedUpdates: t.allowedUpdates,
+	})
+	return err
+}
+
+func (t *Bot) GetUpdates(ctx context.Context) ([]Update, error) {
+	return call[[]Update](ctx, t, endpointGetUpdates, UpdatesRequest{
 		Offset: t.lastUpdateId,
 		AllowedUpdates: t.allowedUpdates,
 		Timeout: 60,
 	})
-	if err != nil {
-		return
-	}
-	res, err := common.Req(http.MethodPost, t.url(endpointGetUpdates), bodyBytes)
-	if err != nil {
-		return
-	}
-	err = json.NewDecoder(res.Body).Decode(&tgRes)
-	if !tgRes.Ok {
-		err = common.ErrNotOk
-		return
-	}
-	output = tgRes.Result
-	return
 }
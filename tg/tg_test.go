@@ -0,0 +1,104 @@
+package tg_test
+
+import (
+	"time"
+	"errors"
+	"context"
+	"testing"
+	"net/http/httptest"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+	"github.com/sergeykochiev/ivgpu-schedule/tg/tgfake"
+)
+
+const chatId = 7
+
+// newBot talks to a fresh fake, backing off for a millisecond at most
+func newBot(t *testing.T) (*tg.Bot, *tgfake.Server) {
+	t.Helper()
+	fake := tgfake.New("test")
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	bot := tg.InitTgBotWithBase("test", tgfake.ApiBase(srv.URL))
+	bot.SetBackoff(tg.Backoff{ Min: time.Millisecond, Max: time.Millisecond })
+	return &bot, fake
+}
+
+func send(bot *tg.Bot, text string) error {
+	return tg.SendMsg(context.Background(), bot, tg.BaseSentMessage{ ChatId: chatId, Text: text })
+}
+
+func edit(bot *tg.Bot, messageId int, text string) error {
+	return tg.EditMsg(context.Background(), bot, tg.BaseEditedMessage{ ChatId: chatId, MessageId: messageId, Text: text })
+}
+
+func TestCallWaitsRetryAfter(t *testing.T) {
+	bot, fake := newBot(t)
+	fake.Fail(tgfake.MethodSendMessage, tgfake.Failure{ Code: 429, Description: "Too Many Requests: retry after 1", RetryAfter: 1 })
+	start := time.Now()
+	if err := send(bot, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("retried after %s, Telegram asked for 1s", waited)
+	}
+	if n := fake.Calls(tgfake.MethodSendMessage); n != 2 {
+		t.Errorf("%d calls, want 2", n)
+	}
+	if n := len(fake.Replies(chatId)); n != 1 {
+		t.Errorf("%d messages sent, want 1", n)
+	}
+}
+
+func TestCallRetriesServerErrors(t *testing.T) {
+	bot, fake := newBot(t)
+	if err := send(bot, "first"); err != nil {
+		t.Fatal(err)
+	}
+	messageId := fake.Replies(chatId)[0].MessageId
+	badGateway := tgfake.Failure{ Code: 502, Description: "Bad Gateway" }
+
+	fake.Fail(tgfake.MethodEditMessage, badGateway, badGateway)
+	if err := edit(bot, messageId, "second"); err != nil {
+		t.Fatalf("edit failed after two 502s: %v", err)
+	}
+	if n := fake.Calls(tgfake.MethodEditMessage); n != 3 {
+		t.Errorf("%d calls, want 3", n)
+	}
+
+	// Gives up after maxAttempts, 5
+	fake.Fail(tgfake.MethodEditMessage, badGateway, badGateway, badGateway, badGateway, badGateway, badGateway)
+	err := edit(bot, messageId, "third")
+	var tgErr *tg.Error
+	if !errors.As(err, &tgErr) || tgErr.Code != 502 {
+		t.Fatalf("err = %v, want the 502", err)
+	}
+	if n := fake.Calls(tgfake.MethodEditMessage); n != 3 + 5 {
+		t.Errorf("%d calls, want 5 more", n - 3)
+	}
+}
+
+// A 5xx may come after the message was delivered, sending it again would
+// show it twice
+func TestCallDoesNotResendAfterServerError(t *testing.T) {
+	bot, fake := newBot(t)
+	fake.Fail(tgfake.MethodSendMessage, tgfake.Failure{ Code: 500, Description: "Internal Server Error" })
+	if err := send(bot, "hi"); err == nil {
+		t.Fatal("send succeeded")
+	}
+	if n := fake.Calls(tgfake.MethodSendMessage); n != 1 {
+		t.Errorf("%d calls, want 1", n)
+	}
+}
+
+func TestCallReturnsClientErrorsAtOnce(t *testing.T) {
+	bot, fake := newBot(t)
+	fake.Fail(tgfake.MethodEditMessage, tgfake.Failure{ Code: 400, Description: "Bad Request: can't parse entities: Unsupported start tag \"b\" at byte offset 0" })
+	err := edit(bot, 1, "<b")
+	var tgErr *tg.Error
+	if !errors.As(err, &tgErr) || tgErr.Code != 400 {
+		t.Fatalf("err = %v, want the 400", err)
+	}
+	if n := fake.Calls(tgfake.MethodEditMessage); n != 1 {
+		t.Errorf("%d calls, want 1", n)
+	}
+}
@@ -0,0 +1,465 @@
+package tgfake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"github.com/sergeykochiev/ivgpu-schedule/tg"
+)
+
+const (
+	MethodGetMe = "getMe"
+	MethodGetUpdates = "getUpdates"
+	MethodSendMessage = "sendMessage"
+	MethodEditMessage = "editMessageText"
+	MethodDeleteMessage = "deleteMessage"
+	MethodAnswerCallbackQuery = "answerCallbackQuery"
+	MethodSendChatAction = "sendChatAction"
+)
+
+// Longest time a single getUpdates call is held open, regardless of the
+// timeout requested by the bot, so that scripted runs stay fast.
+const maxPollWait = 2 * time.Second
+
+var ErrNoReply = errors.New("No reply from bot: ")
+
+// Message is a message sent by the bot, as currently seen by the chat.
+type Message struct {
+	MessageId int
+	ChatId int
+	Text string
+	ParseMode string
+	ReplyMarkup json.RawMessage
+	Deleted bool
+}
+
+// Reply is a single outgoing bot call, recorded in the order it was made.
+type Reply struct {
+	Method string
+	ChatId int
+	MessageId int
+	Text string
+	ParseMode string
+	ReplyMarkup json.RawMessage
+	CallbackQueryId string
+	ShowAlert bool
+}
+
+// Failure is an error response the server gives instead of handling a call
+type Failure struct {
+	Code int
+	Description string
+	RetryAfter int
+}
+
+type chat struct {
+	messages map[int]*Message
+	replies []Reply
+	cursor int
+}
+
+type Server struct {
+	Token string
+	mu sync.Mutex
+	updates []tg.Update
+	nextUpdateId int
+	nextMessageId int
+	nextQueryId int
+	queries map[string]int
+	chats map[int]*chat
+	failures map[string][]Failure
+	calls map[string]int
+	wake chan struct{}
+}
+
+type apiResponse struct {
+	Ok bool `json:"ok"`
+	Result any `json:"result,omitempty"`
+	ErrorCode int `json:"error_code,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters *tg.ResponseParameters `json:"parameters,omitempty"`
+}
+
+type outgoingRequest struct {
+	ChatId int `json:"chat_id"`
+	MessageId int `json:"message_id"`
+	Text string `json:"text"`
+	ParseMode string `json:"parse_mode"`
+	ReplyMarkup json.RawMessage `json:"reply_markup"`
+	CallbackQueryId string `json:"callback_query_id"`
+	ShowAlert bool `json:"show_alert"`
+}
+
+func New(token string) *Server {
+	return &Server{
+		Token: token,
+		nextUpdateId: 1,
+		nextMessageId: 1,
+		nextQueryId: 1,
+		queries: make(map[string]int),
+		chats: make(map[int]*chat),
+		failures: make(map[string][]Failure),
+		calls: make(map[string]int),
+		wake: make(chan struct{}),
+	}
+}
+
+// ApiBase is the value to pass to tg.InitTgBotWithBase for a server
+// listening at the given root URL, e.g. "http://127.0.0.1:8081".
+func ApiBase(root string) string {
+	return strings.TrimSuffix(root, "/") + "/bot"
+}
+
+func (s *Server) chat(id int) *chat {
+	c, ok := s.chats[id]
+	if !ok {
+		c = &chat{ messages: make(map[int]*Message) }
+		s.chats[id] = c
+	}
+	return c
+}
+
+func (s *Server) pushUpdate(upd tg.Update) {
+	upd.UpdateId = s.nextUpdateId
+	s.nextUpdateId++
+	s.updates = append(s.updates, upd)
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// SendText injects a text message written by the user of the given chat.
+func (s *Server) SendText(chatId int, text string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextMessageId
+	s.nextMessageId++
+	s.pushUpdate(tg.Update{
+		Message: tg.ReceivedMessage{
+			MessageId: id,
+			Text: text,
+			Chat: tg.Chat{ Id: chatId },
+			From: tg.User{ Id: chatId },
+		},
+	})
+	return id
+}
+
+// PressButton injects a tap on an inline button of a bot message.
+func (s *Server) PressButton(chatId int, messageId int, data string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.chat(chatId).messages[messageId]
+	if !ok || m.Deleted {
+		return "", fmt.Errorf("message %d not found in chat %d", messageId, chatId)
+	}
+	queryId := fmt.Sprint(s.nextQueryId)
+	s.nextQueryId++
+	s.queries[queryId] = chatId
+	s.pushUpdate(tg.Update{
+		CallbackQuery: tg.CallbackQuery{
+			Id: queryId,
+			Data: data,
+			From: tg.User{ Id: chatId },
+			Message: tg.ReceivedMessage{
+				MessageId: m.MessageId,
+				Text: m.Text,
+				Chat: tg.Chat{ Id: chatId },
+			},
+		},
+	})
+	return queryId, nil
+}
+
+// PressButtonByText finds an inline button by its label on the given bot
+// message and taps it.
+func (s *Server) PressButtonByText(chatId int, messageId int, text string) (string, error) {
+	m, ok := s.Message(chatId, messageId)
+	if !ok {
+		return "", fmt.Errorf("message %d not found in chat %d", messageId, chatId)
+	}
+	for _, b := range(m.InlineButtons()) {
+		if b.Text == text {
+			return s.PressButton(chatId, messageId, b.CallbackData)
+		}
+	}
+	return "", fmt.Errorf("button %q not found on message %d", text, messageId)
+}
+
+// Message returns the current state of a bot message.
+func (s *Server) Message(chatId int, messageId int) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.chat(chatId).messages[messageId]
+	if !ok {
+		return Message{}, false
+	}
+	return *m, true
+}
+
+// Replies returns every outgoing bot call made to the chat so far.
+func (s *Server) Replies(chatId int) []Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Reply(nil), s.chat(chatId).replies...)
+}
+
+// NextReply waits for the next bot call made to the chat that has not yet
+// been consumed by NextReply.
+func (s *Server) NextReply(chatId int, timeout time.Duration) (Reply, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		c := s.chat(chatId)
+		if c.cursor < len(c.replies) {
+			r := c.replies[c.cursor]
+			c.cursor++
+			s.mu.Unlock()
+			return r, nil
+		}
+		wake := s.wake
+		s.mu.Unlock()
+		select {
+		case <-wake:
+		case <-deadline:
+			return Reply{}, errors.Join(ErrNoReply, fmt.Errorf("chat %d, waited %s", chatId, timeout))
+		}
+	}
+}
+
+// ExpectReply waits for the next bot call to the chat and checks that its
+// text contains the given fragment.
+func (s *Server) ExpectReply(chatId int, contains string, timeout time.Duration) (Reply, error) {
+	r, err := s.NextReply(chatId, timeout)
+	if err != nil {
+		return r, err
+	}
+	if !strings.Contains(r.Text, contains) {
+		return r, fmt.Errorf("chat %d: %s %q does not contain %q", chatId, r.Method, r.Text, contains)
+	}
+	return r, nil
+}
+
+// Fail makes the next calls of method fail, one failure per call, in
+// order. The calls are not handled, as if Telegram had refused them.
+func (s *Server) Fail(method string, failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], failures...)
+}
+
+// Calls reports how many times method was called, failed calls included.
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// fail counts the call and pops the failure it is due to get, if any
+func (s *Server) fail(method string) (Failure, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[method]++
+	failures := s.failures[method]
+	if len(failures) == 0 {
+		return Failure{}, false
+	}
+	s.failures[method] = failures[1:]
+	return failures[0], true
+}
+
+// Pending reports how many injected updates the bot has not acknowledged yet.
+func (s *Server) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.updates)
+}
+
+func (r Reply) InlineButtons() []tg.InlineKeyboardButton {
+	return inlineButtons(r.ReplyMarkup)
+}
+
+func (m Message) InlineButtons() []tg.InlineKeyboardButton {
+	return inlineButtons(m.ReplyMarkup)
+}
+
+func inlineButtons(raw json.RawMessage) (buttons []tg.InlineKeyboardButton) {
+	var markup tg.InlineKeyboardMarkup
+	if json.Unmarshal(raw, &markup) != nil {
+		return
+	}
+	for _, row := range(markup.InlineKeyboard) {
+		buttons = append(buttons, row...)
+	}
+	return
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := "/bot" + s.Token + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		writeResponse(w, http.StatusUnauthorized, apiResponse{ ErrorCode: 401, Description: "Unauthorized" })
+		return
+	}
+	method := strings.TrimPrefix(r.URL.Path, prefix)
+	if f, ok := s.fail(method); ok {
+		res := apiResponse{ ErrorCode: f.Code, Description: f.Description }
+		if f.RetryAfter > 0 {
+			res.Parameters = &tg.ResponseParameters{ RetryAfter: f.RetryAfter }
+		}
+		writeResponse(w, f.Code, res)
+		return
+	}
+	if method == MethodGetUpdates {
+		s.handleGetUpdates(w, r)
+		return
+	}
+	var req outgoingRequest
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&req)
+	}
+	status, res := s.handleOutgoing(method, req)
+	writeResponse(w, status, res)
+}
+
+func (s *Server) handleGetUpdates(w http.ResponseWriter, r *http.Request) {
+	var req tg.UpdatesRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	wait := min(time.Duration(req.Timeout) * time.Second, maxPollWait)
+	deadline := time.After(wait)
+	for {
+		s.mu.Lock()
+		s.updates = dropBefore(s.updates, req.Offset)
+		if len(s.updates) > 0 || wait == 0 {
+			out := append([]tg.Update(nil), s.updates...)
+			s.mu.Unlock()
+			writeResponse(w, http.StatusOK, apiResponse{ Ok: true, Result: out })
+			return
+		}
+		wake := s.wake
+		s.mu.Unlock()
+		select {
+		case <-wake:
+		case <-deadline:
+			writeResponse(w, http.StatusOK, apiResponse{ Ok: true, Result: []tg.Update{} })
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func dropBefore(updates []tg.Update, offset int) []tg.Update {
+	i := 0
+	for i < len(updates) && updates[i].UpdateId < offset {
+		i++
+	}
+	return updates[i:]
+}
+
+func (s *Server) handleOutgoing(method string, req outgoingRequest) (int, apiResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() {
+		close(s.wake)
+		s.wake = make(chan struct{})
+	}()
+	switch (method) {
+	case MethodGetMe:
+		return http.StatusOK, apiResponse{ Ok: true, Result: tg.User{ Id: 1 } }
+	case MethodSendChatAction:
+		return http.StatusOK, apiResponse{ Ok: true, Result: true }
+	case MethodAnswerCallbackQuery:
+		if req.CallbackQueryId == "" {
+			return badRequest("query is too old and response timeout expired or query ID is invalid")
+		}
+		// Queries are not tied to a chat in the Bot API, so the answer is
+		// recorded for whichever chat the query was made in.
+		chatId := s.queries[req.CallbackQueryId]
+		s.chat(chatId).replies = append(s.chat(chatId).replies, Reply{
+			Method: method,
+			ChatId: chatId,
+			Text: req.Text,
+			CallbackQueryId: req.CallbackQueryId,
+			ShowAlert: req.ShowAlert,
+		})
+		return http.StatusOK, apiResponse{ Ok: true, Result: true }
+	}
+	if req.ChatId == 0 {
+		return badRequest("chat not found")
+	}
+	c := s.chat(req.ChatId)
+	switch (method) {
+	case MethodSendMessage:
+		if req.Text == "" {
+			return badRequest("message text is empty")
+		}
+		m := &Message{
+			MessageId: s.nextMessageId,
+			ChatId: req.ChatId,
+			Text: req.Text,
+			ParseMode: req.ParseMode,
+			ReplyMarkup: req.ReplyMarkup,
+		}
+		s.nextMessageId++
+		c.messages[m.MessageId] = m
+		c.replies = append(c.replies, replyFrom(method, *m))
+		return http.StatusOK, apiResponse{ Ok: true, Result: m.received() }
+	case MethodEditMessage:
+		m, ok := c.messages[req.MessageId]
+		if !ok || m.Deleted {
+			return badRequest("message to edit not found")
+		}
+		if m.Text == req.Text && string(m.ReplyMarkup) == string(req.ReplyMarkup) {
+			return badRequest("message is not modified: specified new message content and reply markup are exactly the same as a current content and reply markup of the message")
+		}
+		m.Text = req.Text
+		m.ParseMode = req.ParseMode
+		m.ReplyMarkup = req.ReplyMarkup
+		c.replies = append(c.replies, replyFrom(method, *m))
+		return http.StatusOK, apiResponse{ Ok: true, Result: m.received() }
+	case MethodDeleteMessage:
+		m, ok := c.messages[req.MessageId]
+		if !ok || m.Deleted {
+			return badRequest("message to delete not found")
+		}
+		m.Deleted = true
+		c.replies = append(c.replies, replyFrom(method, *m))
+		return http.StatusOK, apiResponse{ Ok: true, Result: true }
+	}
+	return http.StatusNotFound, apiResponse{ ErrorCode: 404, Description: "Not Found: method not found" }
+}
+
+func (m Message) received() tg.ReceivedMessage {
+	return tg.ReceivedMessage{
+		MessageId: m.MessageId,
+		Text: m.Text,
+		Chat: tg.Chat{ Id: m.ChatId },
+	}
+}
+
+func replyFrom(method string, m Message) Reply {
+	return Reply{
+		Method: method,
+		ChatId: m.ChatId,
+		MessageId: m.MessageId,
+		Text: m.Text,
+		ParseMode: m.ParseMode,
+		ReplyMarkup: m.ReplyMarkup,
+	}
+}
+
+func badRequest(description string) (int, apiResponse) {
+	return http.StatusBadRequest, apiResponse{
+		ErrorCode: http.StatusBadRequest,
+		Description: "Bad Request: " + description,
+	}
+}
+
+func writeResponse(w http.ResponseWriter, status int, res apiResponse) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}